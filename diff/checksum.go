@@ -0,0 +1,154 @@
+package diff
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+)
+
+// tableChecksum is the result of ADMIN CHECKSUM TABLE.
+type tableChecksum struct {
+	CRC64Xor   uint64
+	TotalKvs   uint64
+	TotalBytes uint64
+}
+
+func isTiDB(db *sql.DB) (bool, error) {
+	var version string
+	err := db.QueryRow("select version();").Scan(&version)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return strings.Contains(strings.ToLower(version), "tidb"), nil
+}
+
+// isBothTiDB returns true if both databases are TiDB, it's detected only once.
+func (df *Diff) isBothTiDB() bool {
+	df.detectTiDB.Do(func() {
+		tidb1, err := isTiDB(df.db1)
+		if err != nil {
+			log.Warnf("detect whether source db is TiDB failed: %v", err)
+			return
+		}
+		tidb2, err := isTiDB(df.db2)
+		if err != nil {
+			log.Warnf("detect whether target db is TiDB failed: %v", err)
+			return
+		}
+		df.bothTiDB = tidb1 && tidb2
+	})
+	return df.bothTiDB
+}
+
+// getChecksum and getTableID read from TiDB, they're replaced in tests.
+var (
+	getChecksum = adminChecksum
+	getTableID  = tidbTableID
+)
+
+func adminChecksum(db *sql.DB, tblName string) (*tableChecksum, error) {
+	rows, err := querySQL(db, fmt.Sprintf("admin checksum table `%s`;", tblName))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return nil, errors.NotFoundf("checksum of table %s", tblName)
+	}
+
+	var (
+		dbName string
+		name   string
+		cs     tableChecksum
+	)
+	err = rows.Scan(&dbName, &name, &cs.CRC64Xor, &cs.TotalKvs, &cs.TotalBytes)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &cs, nil
+}
+
+// tidbTableID returns the id of the table in TiDB, which is the prefix of all the keys of the table.
+func tidbTableID(db *sql.DB, tblName string) (int64, error) {
+	var id int64
+	err := db.QueryRow("select tidb_table_id from information_schema.tables where table_schema = database() and table_name = ?;", tblName).Scan(&id)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return id, nil
+}
+
+var autoIncrementRegexp = regexp.MustCompile(`\s*AUTO_INCREMENT=\d+`)
+
+// equalLayout tests whether the table have the same layout, the checksum is computed over the encoded key-value
+// pairs so it's comparable only if the tables are created with the same columns, indexes and options.
+func (df *Diff) equalLayout(tblName string) (bool, error) {
+	create1, err := getCreateTable(df.db1, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	create2, err := getCreateTable(df.db2, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	// the next auto increment id doesn't change the layout
+	create1 = autoIncrementRegexp.ReplaceAllString(create1, "")
+	create2 = autoIncrementRegexp.ReplaceAllString(create2, "")
+	return create1 == create2, nil
+}
+
+// equalChecksum tests whether the table is equal by ADMIN CHECKSUM TABLE if both databases are TiDB.
+// It returns true only if the checksums are equal, false means we need to compare the rows to know whether
+// the table is equal. The checksum is computed over the keys containing the table id, so it's compared only if
+// the table have the same id in both databases, which is rare across clusters unless restored from a backup.
+func (df *Diff) equalChecksum(tblName string) (bool, error) {
+	if !df.isBothTiDB() {
+		return false, nil
+	}
+
+	eq, err := df.equalLayout(tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if !eq {
+		log.Infof("table %s have different layout, skip checksum", tblName)
+		return false, nil
+	}
+
+	id1, err := getTableID(df.db1, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	id2, err := getTableID(df.db2, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	if id1 != id2 {
+		log.Infof("table %s have different id, [source] %d [target] %d, skip checksum", tblName, id1, id2)
+		return false, nil
+	}
+
+	cs1, err := getChecksum(df.db1, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	cs2, err := getChecksum(df.db2, tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if *cs1 != *cs2 {
+		log.Infof("table %s have different checksum, [source] %+v [target] %+v, fall back to compare rows", tblName, *cs1, *cs2)
+		return false, nil
+	}
+	return true, nil
+}
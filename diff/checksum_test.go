@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"database/sql"
+
+	. "github.com/pingcap/check"
+)
+
+// fakeTiDB replaces the reads from TiDB by the table id and checksum of each database.
+type fakeTiDB struct {
+	ids       map[*sql.DB]int64
+	checksums map[*sql.DB]tableChecksum
+	// checksumed counts the checksum read
+	checksumed int
+}
+
+func (f *fakeTiDB) install() (restore func()) {
+	oldChecksum, oldTableID := getChecksum, getTableID
+	getChecksum = func(db *sql.DB, tblName string) (*tableChecksum, error) {
+		f.checksumed++
+		cs := f.checksums[db]
+		return &cs, nil
+	}
+	getTableID = func(db *sql.DB, tblName string) (int64, error) {
+		return f.ids[db], nil
+	}
+	return func() {
+		getChecksum, getTableID = oldChecksum, oldTableID
+	}
+}
+
+func newTiDBDiff(cfg *Config, db1, db2 *sql.DB) *Diff {
+	df := New(cfg, db1, db2)
+	df.detectTiDB.Do(func() {})
+	df.bothTiDB = true
+	return df
+}
+
+func (s *testHermeticSuite) TestEqualChecksum(c *C) {
+	db1 := s.ts.resetDB(c, "db1", "create table t(id bigint primary key, v bigint)", "insert into t values(1, 1)")
+	defer db1.Close()
+	db2 := s.ts.resetDB(c, "db2", "create table t(id bigint primary key, v bigint)", "insert into t values(1, 2)")
+	defer db2.Close()
+
+	cs := tableChecksum{CRC64Xor: 1, TotalKvs: 1, TotalBytes: 10}
+	fake := &fakeTiDB{
+		ids:       map[*sql.DB]int64{db1: 100, db2: 100},
+		checksums: map[*sql.DB]tableChecksum{db1: cs, db2: cs},
+	}
+	defer fake.install()()
+
+	// match, the rows are not compared
+	eq, err := newTiDBDiff(nil, db1, db2).equalChecksum("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+	eq, err = newTiDBDiff(nil, db1, db2).EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	// mismatch, fall back to compare the rows
+	fake.checksums[db2] = tableChecksum{CRC64Xor: 2, TotalKvs: 1, TotalBytes: 10}
+	eq, err = newTiDBDiff(nil, db1, db2).equalChecksum("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	eq, err = newTiDBDiff(nil, db1, db2).EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+
+	// the checksum is not comparable if the table ids are different
+	fake.checksums[db2] = cs
+	fake.ids[db2] = 200
+	fake.checksumed = 0
+	eq, err = newTiDBDiff(nil, db1, db2).equalChecksum("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	c.Assert(fake.checksumed, Equals, 0)
+
+	// or the layouts are different
+	fake.ids[db2] = 100
+	_, err = db2.Exec("alter table t add column c bigint")
+	c.Assert(err, IsNil)
+	eq, err = newTiDBDiff(nil, db1, db2).equalChecksum("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	c.Assert(fake.checksumed, Equals, 0)
+
+	// or any one is not TiDB
+	eq, err = New(nil, db1, db2).equalChecksum("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	c.Assert(fake.checksumed, Equals, 0)
+
+	// tried by default, but not if disabled
+	c.Assert(defaultConfig.TiDBChecksum, IsTrue)
+	fake.checksums[db2] = cs
+	_, err = db2.Exec("alter table t drop column c")
+	c.Assert(err, IsNil)
+	cfg := *defaultConfig
+	cfg.TiDBChecksum = false
+	eq, err = newTiDBDiff(&cfg, db1, db2).EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	c.Assert(fake.checksumed, Equals, 0)
+}
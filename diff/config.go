@@ -1,6 +1,9 @@
 package diff
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // Config is the diff configuration.
 type Config struct {
@@ -8,6 +11,38 @@ type Config struct {
 	EqualCreateTable bool `toml:"equal-create-table" json:"equal-create-table"`
 	EqualRowCount    bool `toml:"equal-row-count" json:"equal-row-count"`
 	EqualData        bool `toml:"equal-data" json:"equal-data"`
+	// EqualTableOptions checks the next AUTO_INCREMENT id of target is not less than the source, so a failover
+	// won't allocate duplicate ids, and AUTO_ID_CACHE, SHARD_ROW_ID_BITS, AUTO_RANDOM and the comment are the same.
+	EqualTableOptions bool `toml:"equal-table-options" json:"equal-table-options"`
+	// EqualPartitions compares the partition definitions, and compares the data of partitioned table
+	// partition by partition with at most PartitionConcurrency partitions at the same time.
+	EqualPartitions      bool `toml:"equal-partitions" json:"equal-partitions"`
+	PartitionConcurrency int  `toml:"partition-concurrency" json:"partition-concurrency"`
+
+	EqualViews     bool `toml:"equal-views" json:"equal-views"`
+	EqualTriggers  bool `toml:"equal-triggers" json:"equal-triggers"`
+	EqualRoutines  bool `toml:"equal-routines" json:"equal-routines"`
+	EqualSequences bool `toml:"equal-sequences" json:"equal-sequences"`
+	// EqualUsers compares the users and grants, it needs the privilege to read mysql.user.
+	EqualUsers bool `toml:"equal-users" json:"equal-users"`
+
+	// MaxRetry is how many times to retry a table if get retryable error, including the table compared
+	// partition by partition, the backoff starts from RetryBackoff and doubles each time.
+	MaxRetry     int           `toml:"max-retry" json:"max-retry"`
+	RetryBackoff time.Duration `toml:"retry-backoff" json:"retry-backoff"`
+
+	// TiDBChecksum tries ADMIN CHECKSUM TABLE first if both databases are TiDB and the table have the same id,
+	// the rows are compared only if the checksums are different. The ids differ across clusters in most cases, the
+	// checksum is skipped then.
+	TiDBChecksum bool `toml:"tidb-checksum" json:"tidb-checksum"`
+
+	// MaxSampleRows is how many different rows of a table at most Report shows, 0 shows none.
+	MaxSampleRows int `toml:"max-sample-rows" json:"max-sample-rows"`
+	// MaxMismatchRows is how many different rows of a table at most MultiDiff keeps, 0 keeps none,
+	// the rows are counted anyway.
+	MaxMismatchRows int `toml:"max-mismatch-rows" json:"max-mismatch-rows"`
+	// Redact hides the values of sensitive columns wherever Diff outputs row data.
+	Redact RedactConfig `toml:"redact" json:"redact"`
 }
 
 var defaultConfig = &Config{
@@ -15,6 +50,22 @@ var defaultConfig = &Config{
 	EqualCreateTable: true,
 	EqualRowCount:    true,
 	EqualData:        true,
+
+	EqualPartitions:      true,
+	PartitionConcurrency: 4,
+
+	EqualViews:     true,
+	EqualTriggers:  true,
+	EqualRoutines:  true,
+	EqualSequences: true,
+
+	MaxRetry:     5,
+	RetryBackoff: time.Second,
+
+	TiDBChecksum: true,
+
+	MaxSampleRows:   10,
+	MaxMismatchRows: 100,
 }
 
 func (c *Config) String() string {
@@ -0,0 +1,327 @@
+package diff
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// Dialect is the SQL dialect of a database, DBSource lists the tables and scans the rows through it.
+//
+// The type name and value of the columns are normalized into the form of MySQL, so the rows read from
+// databases of different dialects can be compared.
+type Dialect interface {
+	// Name returns the name of the dialect.
+	Name() string
+	// Tables returns the name of the base tables in order.
+	Tables(db *sql.DB) ([]string, error)
+	// OrderByColumns returns the columns identifying a row in order, like the primary key,
+	// or all columns if no such key.
+	OrderByColumns(db *sql.DB, tblName string) ([]string, error)
+	// QuoteName quotes the name of a table or column.
+	QuoteName(name string) string
+	// NormalizeType returns the MySQL type name of the database type name.
+	NormalizeType(typeName string) string
+	// NormalizeValue returns the value in the form of MySQL, typeName is the database type name of the column.
+	NormalizeValue(typeName string, v sql.RawBytes) sql.RawBytes
+}
+
+// The dialects supported.
+var (
+	MySQL  Dialect = mysqlDialect{}
+	SQLite Dialect = sqliteDialect{}
+)
+
+// selectOrderedSQL returns the sql to select all the rows of the table ordered by the order by key.
+func selectOrderedSQL(d Dialect, db *sql.DB, tblName string) (string, error) {
+	cols, err := d.OrderByColumns(db, tblName)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	quoted := make([]string, 0, len(cols))
+	for _, col := range cols {
+		quoted = append(quoted, d.QuoteName(col))
+	}
+	return fmt.Sprintf("select * from %s order by %s", d.QuoteName(tblName), strings.Join(quoted, ",")), nil
+}
+
+// canonicalValue returns the value in a canonical form of the MySQL type name, so the same value formatted
+// differently by databases of different dialects is equal, like DECIMAL 1.5 and 1.50, DOUBLE 1e20 and 1e+20,
+// DATETIME 2020-01-02 03:04:05 and 2020-01-02 03:04:05.000000.
+func canonicalValue(typeName string, v sql.RawBytes) sql.RawBytes {
+	if v == nil {
+		return v
+	}
+
+	switch typeName {
+	case "DECIMAL":
+		if r, ok := new(big.Rat).SetString(string(v)); ok {
+			return sql.RawBytes(r.RatString())
+		}
+	case "FLOAT", "DOUBLE":
+		bitSize := 64
+		if typeName == "FLOAT" {
+			bitSize = 32
+		}
+		if f, err := strconv.ParseFloat(string(v), bitSize); err == nil {
+			return sql.RawBytes(strconv.FormatFloat(f, 'g', -1, bitSize))
+		}
+	case "DATETIME", "TIMESTAMP", "TIME":
+		if bytes.IndexByte(v, '.') >= 0 {
+			return bytes.TrimRight(bytes.TrimRight(v, "0"), ".")
+		}
+	}
+	return v
+}
+
+// canonicalRows returns the rows in the canonical form of the column types, see canonicalValue.
+type canonicalRows struct {
+	Rows
+	row []sql.RawBytes
+}
+
+func (r *canonicalRows) Row() []sql.RawBytes {
+	cols := r.Columns()
+	r.row = r.row[:0]
+	for i, v := range r.Rows.Row() {
+		r.row = append(r.row, canonicalValue(cols[i].Type, v))
+	}
+	return r.row
+}
+
+// typeFamily returns the family of the MySQL type name, the types of a family have the same canonical values, like
+// the integers of different sizes, so the columns of databases of different dialects are compared by the families.
+func typeFamily(typeName string) string {
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT":
+		return "INTEGER"
+	case "CHAR", "VARCHAR", "TINYTEXT", "TEXT", "MEDIUMTEXT", "LONGTEXT":
+		return "STRING"
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+		return "BYTES"
+	case "DATETIME", "TIMESTAMP":
+		return "DATETIME"
+	}
+	return typeName
+}
+
+// mysqlDialect is the dialect of MySQL and TiDB.
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Tables(db *sql.DB) ([]string, error) {
+	tbls, err := getTables(db)
+	return tbls, errors.Trace(err)
+}
+
+func (mysqlDialect) OrderByColumns(db *sql.DB, tblName string) ([]string, error) {
+	cols, err := getOrderByColumns(db, tblName)
+	return cols, errors.Trace(err)
+}
+
+func (mysqlDialect) QuoteName(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (mysqlDialect) NormalizeType(typeName string) string {
+	return typeName
+}
+
+func (mysqlDialect) NormalizeValue(typeName string, v sql.RawBytes) sql.RawBytes {
+	return v
+}
+
+// sqliteDialect is the dialect of SQLite, the rows are expected to be read by github.com/mattn/go-sqlite3.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Tables(db *sql.DB) ([]string, error) {
+	rows, err := querySQL(db, "select name from sqlite_master where type = 'table' and name not like 'sqlite_%' order by name;")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var tbls []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tbls = append(tbls, name)
+	}
+	return tbls, errors.Trace(rows.Err())
+}
+
+func (d sqliteDialect) OrderByColumns(db *sql.DB, tblName string) ([]string, error) {
+	rows, err := querySQL(db, fmt.Sprintf("pragma table_info(%s);", d.QuoteName(tblName)))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	type column struct {
+		name string
+		// the position in the primary key starts from 1, 0 if not in the primary key
+		pk int
+	}
+	var cols []column
+	for rows.Next() {
+		var (
+			cid     int
+			col     column
+			typ     string
+			notNull bool
+			dflt    sql.RawBytes
+		)
+		err := rows.Scan(&cid, &col.name, &typ, &notNull, &dflt, &col.pk)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		cols = append(cols, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var keys []column
+	for _, col := range cols {
+		if col.pk > 0 {
+			keys = append(keys, col)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].pk < keys[j].pk })
+	if len(keys) == 0 {
+		// if no primary key found, use all fields as order by key
+		keys = cols
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.name)
+	}
+	return names, nil
+}
+
+func (sqliteDialect) QuoteName(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (sqliteDialect) NormalizeType(typeName string) string {
+	typeName = strings.ToUpper(strings.TrimSpace(typeName))
+	if idx := strings.IndexByte(typeName, '('); idx >= 0 {
+		typeName = strings.TrimSpace(typeName[:idx])
+	}
+
+	switch typeName {
+	case "INTEGER":
+		return "BIGINT"
+	case "REAL", "DOUBLE PRECISION":
+		return "DOUBLE"
+	case "NUMERIC":
+		return "DECIMAL"
+	case "BOOLEAN", "BOOL":
+		return "TINYINT"
+	case "TEXT", "CLOB", "CHARACTER", "NCHAR", "NVARCHAR", "VARYING CHARACTER", "NATIVE CHARACTER":
+		return "VARCHAR"
+	case "":
+		// column without declared type, like the result of an expression
+		return "BLOB"
+	}
+	return typeName
+}
+
+func (d sqliteDialect) NormalizeValue(typeName string, v sql.RawBytes) sql.RawBytes {
+	if v == nil {
+		return v
+	}
+
+	params := typeParams(typeName)
+	switch d.NormalizeType(typeName) {
+	case "TINYINT":
+		// the driver returns bool for a column declared as boolean
+		switch string(v) {
+		case "true":
+			return sql.RawBytes("1")
+		case "false":
+			return sql.RawBytes("0")
+		}
+	case "DECIMAL":
+		// SQLite keeps a decimal as an integer or a real, MySQL formats it by the declared scale like 1.50
+		if len(params) == 2 {
+			if r, ok := new(big.Rat).SetString(string(v)); ok {
+				return sql.RawBytes(r.FloatString(params[1]))
+			}
+		}
+	case "DOUBLE", "FLOAT":
+		// SQLite keeps a float as a double, MySQL formats it in the shortest form of its precision like 1e20
+		bitSize := 64
+		if d.NormalizeType(typeName) == "FLOAT" {
+			bitSize = 32
+		}
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return sql.RawBytes(strings.Replace(strconv.FormatFloat(f, 'g', -1, bitSize), "e+", "e", 1))
+		}
+	case "DATETIME", "TIMESTAMP":
+		// the driver returns time.Time formatted as RFC3339Nano for a column declared as datetime,
+		// or the text stored for a column declared with the fractional seconds precision like datetime(6)
+		if t, ok := parseSQLiteTime(v); ok {
+			layout := "2006-01-02 15:04:05.999999"
+			if len(params) == 1 && params[0] > 0 {
+				// MySQL formats all the digits of the precision like 03:04:05.000000
+				layout = "2006-01-02 15:04:05." + strings.Repeat("0", params[0])
+			} else if len(params) == 1 {
+				layout = "2006-01-02 15:04:05"
+			}
+			return sql.RawBytes(t.Format(layout))
+		}
+	case "DATE":
+		if t, ok := parseSQLiteTime(v); ok {
+			return sql.RawBytes(t.Format("2006-01-02"))
+		}
+	}
+	return v
+}
+
+// typeParams returns the numbers in the parentheses of the type name, like [10 2] of DECIMAL(10,2).
+func typeParams(typeName string) []int {
+	start := strings.IndexByte(typeName, '(')
+	end := strings.LastIndexByte(typeName, ')')
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var params []int
+	for _, s := range strings.Split(typeName[start+1:end], ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil
+		}
+		params = append(params, n)
+	}
+	return params
+}
+
+func parseSQLiteTime(v sql.RawBytes) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, string(v)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
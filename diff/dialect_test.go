@@ -0,0 +1,167 @@
+//go:build cgo
+
+package diff
+
+import (
+	"database/sql"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testDialectSuite{})
+
+type testDialectSuite struct{}
+
+func openSQLite(c *C, stmts ...string) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(c.MkDir(), "test.db"))
+	c.Assert(err, IsNil)
+	for _, stmt := range stmts {
+		_, err = db.Exec(stmt)
+		c.Assert(err, IsNil, Commentf("stmt: %s", stmt))
+	}
+	return db
+}
+
+func (s *testDialectSuite) TestSQLiteOrderByColumns(c *C) {
+	db := openSQLite(c,
+		"create table t1(a int, b int, c int, primary key(c, a))",
+		"create table t2(a int, b text)",
+		"create table a_table(id integer primary key)",
+	)
+	defer db.Close()
+
+	tables, err := SQLite.Tables(db)
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, []string{"a_table", "t1", "t2"})
+
+	cols, err := SQLite.OrderByColumns(db, "t1")
+	c.Assert(err, IsNil)
+	c.Assert(cols, DeepEquals, []string{"c", "a"})
+
+	cols, err = SQLite.OrderByColumns(db, "t2")
+	c.Assert(err, IsNil)
+	c.Assert(cols, DeepEquals, []string{"a", "b"})
+}
+
+func (s *testDialectSuite) TestSQLiteNormalize(c *C) {
+	c.Assert(SQLite.NormalizeType("integer"), Equals, "BIGINT")
+	c.Assert(SQLite.NormalizeType("varchar(255)"), Equals, "VARCHAR")
+	c.Assert(SQLite.NormalizeType("json"), Equals, "JSON")
+
+	c.Assert(string(SQLite.NormalizeValue("boolean", sql.RawBytes("true"))), Equals, "1")
+	c.Assert(string(SQLite.NormalizeValue("datetime", sql.RawBytes("2020-01-02T03:04:05Z"))), Equals, "2020-01-02 03:04:05")
+	c.Assert(string(SQLite.NormalizeValue("date", sql.RawBytes("2020-01-02T00:00:00Z"))), Equals, "2020-01-02")
+	c.Assert(SQLite.NormalizeValue("text", nil), IsNil)
+
+	// formatted as MySQL by the declared type
+	c.Assert(string(SQLite.NormalizeValue("DECIMAL(10,2)", sql.RawBytes("1.5"))), Equals, "1.50")
+	c.Assert(string(SQLite.NormalizeValue("DECIMAL(10,2)", sql.RawBytes("3"))), Equals, "3.00")
+	c.Assert(string(SQLite.NormalizeValue("NUMERIC", sql.RawBytes("1.5"))), Equals, "1.5")
+	c.Assert(string(SQLite.NormalizeValue("DOUBLE", sql.RawBytes("1e+20"))), Equals, "1e20")
+	c.Assert(string(SQLite.NormalizeValue("FLOAT", sql.RawBytes("1.100000023841858"))), Equals, "1.1")
+	c.Assert(string(SQLite.NormalizeValue("DATETIME(6)", sql.RawBytes("2020-01-02 03:04:05"))), Equals, "2020-01-02 03:04:05.000000")
+	c.Assert(string(SQLite.NormalizeValue("DATETIME(3)", sql.RawBytes("2020-01-02 03:04:05.12"))), Equals, "2020-01-02 03:04:05.120")
+	c.Assert(string(SQLite.NormalizeValue("DATETIME(0)", sql.RawBytes("2020-01-02 03:04:05"))), Equals, "2020-01-02 03:04:05")
+}
+
+func (s *testDialectSuite) TestDiffSQLite(c *C) {
+	schema := "create table t(id integer primary key, v varchar(32), created datetime, ok boolean, doc json)"
+	db1 := openSQLite(c, schema,
+		`insert into t values(1, 'a', '2020-01-02 03:04:05', 1, '{"a":1,"b":2}')`,
+		`insert into t values(2, null, null, 0, null)`,
+	)
+	defer db1.Close()
+	db2 := openSQLite(c, schema,
+		`insert into t values(2, null, null, 0, null)`,
+		`insert into t values(1, 'a', '2020-01-02 03:04:05', 1, '{"b": 2, "a": 1}')`,
+	)
+	defer db2.Close()
+
+	src1 := NewDBSourceWithDialect(db1, SQLite)
+	src2 := NewDBSourceWithDialect(db2, SQLite)
+	eq, err := NewWithSource(nil, src1, src2).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	// the normalized rows is the same as MySQL returns
+	rows, err := src1.Rows("t")
+	c.Assert(err, IsNil)
+	defer rows.Close()
+	c.Assert(rows.Next(), IsTrue)
+	var values []string
+	for _, v := range rows.Row() {
+		values = append(values, string(v))
+	}
+	c.Assert(values, DeepEquals, []string{"1", "a", "2020-01-02 03:04:05", "1", `{"a":1,"b":2}`})
+
+	_, err = db2.Exec("update t set v = '' where id = 2")
+	c.Assert(err, IsNil)
+	eq, err = NewWithSource(nil, src1, src2).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+}
+
+func (s *testHermeticSuite) TestDiffMySQLSQLite(c *C) {
+	mysqlDB := s.ts.resetDB(c, "db1",
+		"create table t(id bigint primary key, v varchar(32), price decimal(10,2), ratio double, f float, created datetime(6), ok boolean, doc json)",
+		`insert into t values(1, 'a', 1.5, 0.1, 1.1, '2020-01-02 03:04:05', true, '{"a":1,"b":2}')`,
+		`insert into t values(2, null, 3, 1e20, 2.5, '2020-01-02 03:04:05.123456', false, null)`,
+	)
+	defer mysqlDB.Close()
+	sqliteDB := openSQLite(c,
+		"create table t(id integer primary key, v varchar(32), price decimal(10,2), ratio double, f float, created datetime(6), ok boolean, doc json)",
+		`insert into t values(1, 'a', 1.50, 0.1, 1.1, '2020-01-02 03:04:05', 1, '{"b": 2, "a": 1}')`,
+		`insert into t values(2, null, 3, 1e20, 2.5, '2020-01-02 03:04:05.123456', 0, null)`,
+	)
+	defer sqliteDB.Close()
+
+	src1 := NewDBSource(mysqlDB)
+	src2 := NewDBSourceWithDialect(sqliteDB, SQLite)
+	eq, err := NewWithSource(nil, src1, src2).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	for _, change := range []struct{ stmt, revert string }{
+		{"update t set price = 1.51 where id = 1", "update t set price = 1.5 where id = 1"},
+		{"update t set ratio = 0.2 where id = 1", "update t set ratio = 0.1 where id = 1"},
+		{"update t set f = 1.2 where id = 1", "update t set f = 1.1 where id = 1"},
+		{"update t set created = '2020-01-02 03:04:05.1' where id = 1", "update t set created = '2020-01-02 03:04:05' where id = 1"},
+	} {
+		_, err = sqliteDB.Exec(change.stmt)
+		c.Assert(err, IsNil)
+		eq, err = NewWithSource(nil, src1, src2).Equal()
+		c.Assert(err, IsNil)
+		c.Assert(eq, IsFalse, Commentf("stmt: %s", change.stmt))
+
+		_, err = sqliteDB.Exec(change.revert)
+		c.Assert(err, IsNil)
+		eq, err = NewWithSource(nil, src1, src2).Equal()
+		c.Assert(err, IsNil)
+		c.Assert(eq, IsTrue, Commentf("stmt: %s", change.revert))
+	}
+
+	// the report agrees with Equal on the columns of the same type family, like INT and INTEGER, TEXT and VARCHAR
+	_, err = mysqlDB.Exec("create table u(id int primary key, v text)")
+	c.Assert(err, IsNil)
+	_, err = mysqlDB.Exec("insert into u values(1, 'a'), (2, 'b')")
+	c.Assert(err, IsNil)
+	_, err = sqliteDB.Exec("create table u(id integer primary key, v text)")
+	c.Assert(err, IsNil)
+	_, err = sqliteDB.Exec("insert into u values(1, 'a'), (2, 'b')")
+	c.Assert(err, IsNil)
+	report, err := NewWithSource(nil, src1, src2).Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Equal(), IsTrue, Commentf("report: %s", report))
+
+	_, err = sqliteDB.Exec("update u set v = 'c' where id = 2")
+	c.Assert(err, IsNil)
+	report, err = NewWithSource(nil, src1, src2).Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Differences, HasLen, 1)
+	c.Assert(report.Differences[0].Reason, Equals, "different data")
+	c.Assert(report.Differences[0].Rows, DeepEquals, []RowSample{
+		{Key: "`id`=2", Source: "`id`=2, `v`=b", Target: "`id`=2, `v`=c"},
+	})
+}
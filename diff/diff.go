@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/ngaut/log"
 	"github.com/onsi/gomega"
@@ -16,32 +18,98 @@ func init() {
 
 // Diff contains two sql DB, used for comparing.
 type Diff struct {
-	cfg *Config
+	cfg  *Config
+	src1 RowSource
+	src2 RowSource
+	// db1 and db2 are nil if the source is not a MySQL or TiDB database,
+	// only the data is compared if any one of them is nil.
 	db1 *sql.DB
 	db2 *sql.DB
+
+	detectTiDB sync.Once
+	bothTiDB   bool
+
+	progress progressTracker
 }
 
 // New returns a Diff instance.
 func New(cfg *Config, db1, db2 *sql.DB) *Diff {
+	return NewWithSource(cfg, NewDBSource(db1), NewDBSource(db2))
+}
+
+// NewWithSource returns a Diff instance comparing two RowSource.
+func NewWithSource(cfg *Config, src1, src2 RowSource) *Diff {
 	if cfg == nil {
 		cfg = defaultConfig
 	}
-	return &Diff{
-		cfg: cfg,
-		db1: db1,
-		db2: db2,
+	df := &Diff{
+		cfg:  cfg,
+		src1: src1,
+		src2: src2,
+	}
+	if s, ok := src1.(*DBSource); ok && s.Dialect() == MySQL {
+		df.db1 = s.DB()
+	}
+	if s, ok := src2.(*DBSource); ok && s.Dialect() == MySQL {
+		df.db2 = s.DB()
+	}
+	return df
+}
+
+// bothDB returns true if both sources are MySQL or TiDB database, the checks other than data need it.
+func (df *Diff) bothDB() bool {
+	return df.db1 != nil && df.db2 != nil
+}
+
+// partitionedSources returns both sources if they can read the partitions of a table.
+func (df *Diff) partitionedSources() (partitionedSource, partitionedSource, bool) {
+	ps1, ok1 := asPartitionedSource(df.src1)
+	ps2, ok2 := asPartitionedSource(df.src2)
+	return ps1, ps2, ok1 && ok2
+}
+
+// asPartitionedSource returns src as partitionedSource, DBSource of the databases other than MySQL
+// is not partitioned.
+func asPartitionedSource(src RowSource) (partitionedSource, bool) {
+	if s, ok := src.(*DBSource); ok && s.Dialect() != MySQL {
+		return nil, false
 	}
+	ps, ok := src.(partitionedSource)
+	return ps, ok
+}
+
+// bothPartitioned returns true if the partitions of both sources can be compared.
+func (df *Diff) bothPartitioned() bool {
+	_, _, ok := df.partitionedSources()
+	return ok
+}
+
+// crossDialect returns true if the sources are databases of different dialects, their values are compared in the
+// canonical form of the column types then.
+func (df *Diff) crossDialect() bool {
+	s1, ok1 := df.src1.(*DBSource)
+	s2, ok2 := df.src2.(*DBSource)
+	return ok1 && ok2 && s1.Dialect() != s2.Dialect()
+}
+
+// rows returns the rows of the table read from src, in the canonical form if crossDialect.
+func (df *Diff) rows(src RowSource, tblName string) (Rows, error) {
+	rows, err := src.Rows(tblName)
+	if err != nil || !df.crossDialect() {
+		return rows, err
+	}
+	return &canonicalRows{Rows: rows}, nil
 }
 
 // Equal tests whether two database have same data and schema.
 func (df *Diff) Equal() (eq bool, err error) {
-	tbls1, err := getTables(df.db1)
+	tbls1, err := df.src1.Tables()
 	if err != nil {
 		err = errors.Trace(err)
 		return
 	}
 
-	tbls2, err := getTables(df.db2)
+	tbls2, err := df.src2.Tables()
 	if err != nil {
 		err = errors.Trace(err)
 		return
@@ -53,32 +121,232 @@ func (df *Diff) Equal() (eq bool, err error) {
 		return false, nil
 	}
 
+	df.progress.reset(len(tbls1))
+	for _, tblName := range tbls1 {
+		eq, err = df.equalTableWithRetry(tblName)
+		if err != nil || !eq {
+			err = errors.Trace(err)
+			return
+		}
+		df.progress.tableDone()
+	}
+
+	report := new(Report)
+	err = df.diffObjects(report)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	return report.Equal(), nil
+}
+
+// Report compares the two databases like Equal, but it doesn't stop at the first difference
+// and returns all the differences found.
+func (df *Diff) Report() (*Report, error) {
+	report := new(Report)
+
+	tables, err := df.EqualTables()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tbls1, err := df.src1.Tables()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	tbls2, err := df.src2.Tables()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defs1 := make(objectDefs, len(tbls1))
 	for _, tblName := range tbls1 {
-		if df.cfg.EqualIndex {
-			eq, err = df.EqualIndex(tblName)
+		defs1[tblName] = ""
+	}
+	defs2 := make(objectDefs, len(tbls2))
+	for _, tblName := range tbls2 {
+		defs2[tblName] = ""
+	}
+	for _, d := range compareObjectDefs(ObjectTable, defs1, defs2) {
+		report.add(d)
+		delete(tables, d.Name)
+	}
+
+	names := make([]string, 0, len(tables))
+	for tblName := range tables {
+		names = append(names, tblName)
+	}
+	sort.Strings(names)
+	for _, tblName := range names {
+		if tables[tblName] {
+			continue
+		}
+
+		if df.cfg.EqualTableOptions && df.bothDB() {
+			eq, opts1, opts2, err := df.equalTableOptions(tblName)
 			if err != nil {
-				err = errors.Trace(err)
-				return
+				return nil, errors.Trace(err)
 			}
 			if !eq {
-				log.Infof("table have different index: %s\n", tblName)
-				return
+				report.add(&Difference{Object: ObjectTable, Name: tblName, Reason: "different table options", Source: opts1, Target: opts2})
+				continue
 			}
 		}
 
-		eq, err = df.EqualTable(tblName)
-		if err != nil || !eq {
-			err = errors.Trace(err)
-			return
+		if df.cfg.EqualPartitions && df.bothPartitioned() {
+			eq, def1, def2, err := df.equalPartitionDefs(tblName)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if !eq {
+				report.add(&Difference{Object: ObjectTable, Name: tblName, Reason: "different partition definition", Source: def1, Target: def2})
+				continue
+			}
+		}
+
+		reason, err := df.tableDifference(tblName)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		d := &Difference{Object: ObjectTable, Name: tblName, Reason: reason}
+		if reason == "different data" {
+			d.Rows, err = df.sampleRows(tblName)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
 		}
+		report.add(d)
 	}
 
-	return
+	err = df.diffObjects(report)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return report, nil
+}
+
+// tableDifference returns why the table is not equal, the index, the columns or the data is different.
+func (df *Diff) tableDifference(tblName string) (string, error) {
+	if df.cfg.EqualIndex && df.bothDB() {
+		eq, err := df.EqualIndex(tblName)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if !eq {
+			return "different index", nil
+		}
+	}
+
+	eq, err := df.equalTableColumns(tblName)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if !eq {
+		return "different schema", nil
+	}
+	return "different data", nil
+}
+
+// equalTableColumns tests whether the table have the same columns in both sources.
+func (df *Diff) equalTableColumns(tblName string) (bool, error) {
+	rows1, err := df.src1.Rows(tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer rows1.Close()
+
+	rows2, err := df.src2.Rows(tblName)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer rows2.Close()
+
+	return df.sameColumns(rows1.Columns(), rows2.Columns()), nil
+}
+
+// sameColumns tests whether the columns are the same, the types are compared by the families if crossDialect.
+func (df *Diff) sameColumns(cols1, cols2 []Column) bool {
+	if !df.crossDialect() {
+		return equalColumns(cols1, cols2)
+	}
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for i := range cols1 {
+		if cols1[i].Name != cols2[i].Name || typeFamily(cols1[i].Type) != typeFamily(cols2[i].Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualTables tests every table found in either database and returns whether
+// each one is equal. A table that only exists on one side is reported as not equal.
+func (df *Diff) EqualTables() (map[string]bool, error) {
+	tbls1, err := df.src1.Tables()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	tbls2, err := df.src2.Tables()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	result := make(map[string]bool, len(tbls1))
+	for _, tblName := range tbls1 {
+		result[tblName] = false
+	}
+	exist := make(map[string]struct{}, len(tbls2))
+	for _, tblName := range tbls2 {
+		exist[tblName] = struct{}{}
+		result[tblName] = false
+	}
+
+	var common int
+	for _, tblName := range tbls1 {
+		if _, ok := exist[tblName]; ok {
+			common++
+		}
+	}
+
+	df.progress.reset(common)
+	for _, tblName := range tbls1 {
+		if _, ok := exist[tblName]; !ok {
+			continue
+		}
+
+		eq, err := df.equalTableWithRetry(tblName)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		result[tblName] = eq
+		df.progress.tableDone()
+	}
+
+	return result, nil
+}
+
+// equalTableAndIndex tests whether two database table have same index, data and schema.
+func (df *Diff) equalTableAndIndex(tblName string) (bool, error) {
+	if df.cfg.EqualIndex && df.bothDB() {
+		eq, err := df.EqualIndex(tblName)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if !eq {
+			log.Infof("table have different index: %s\n", tblName)
+			return false, nil
+		}
+	}
+
+	eq, err := df.EqualTable(tblName)
+	return eq, errors.Trace(err)
 }
 
 // EqualTable tests whether two database table have same data and schema.
 func (df *Diff) EqualTable(tblName string) (eq bool, err error) {
-	if df.cfg.EqualCreateTable {
+	if df.cfg.EqualCreateTable && df.bothDB() {
 		eq, err = df.equalCreateTable(tblName)
 		if err != nil {
 			return eq, errors.Trace(err)
@@ -89,7 +357,39 @@ func (df *Diff) EqualTable(tblName string) (eq bool, err error) {
 		}
 	}
 
-	if df.cfg.EqualRowCount {
+	if df.cfg.EqualTableOptions && df.bothDB() {
+		eq, _, _, err = df.equalTableOptions(tblName)
+		if err != nil {
+			return eq, errors.Trace(err)
+		}
+		if !eq {
+			log.Infof("table have different options: %s\n", tblName)
+			return eq, err
+		}
+	}
+
+	if df.cfg.EqualPartitions && df.bothPartitioned() {
+		eq, _, _, err = df.equalPartitionDefs(tblName)
+		if err != nil {
+			return eq, errors.Trace(err)
+		}
+		if !eq {
+			log.Infof("table have different partition definition: %s\n", tblName)
+			return eq, err
+		}
+	}
+
+	if df.cfg.EqualData && df.cfg.TiDBChecksum && df.bothDB() {
+		eq, err = df.equalChecksum(tblName)
+		if err != nil {
+			return eq, errors.Trace(err)
+		}
+		if eq {
+			return eq, nil
+		}
+	}
+
+	if df.cfg.EqualRowCount && df.bothDB() {
 		eq, err = df.equalTableRowCount(tblName)
 		if err != nil {
 			return eq, errors.Trace(err)
@@ -182,33 +482,45 @@ func (df *Diff) equalTableRowCount(tblName string) (bool, error) {
 }
 
 func (df *Diff) equalTableData(tblName string) (bool, error) {
-	rows1, err := getTableRows(df.db1, tblName)
+	if df.cfg.EqualPartitions && df.bothPartitioned() {
+		partitions, err := df.commonPartitions(tblName)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		if len(partitions) > 0 {
+			return df.equalPartitionsData(tblName, partitions)
+		}
+	}
+
+	return df.equalPartitionData(tblName, "")
+}
+
+// equalPartitionData compares the data of one partition, or the whole table if partition is empty.
+func (df *Diff) equalPartitionData(tblName string, partition string) (bool, error) {
+	rows1, err := df.partitionRows(df.src1, tblName, partition)
 	if err != nil {
 		return false, errors.Trace(err)
 	}
 	defer rows1.Close()
 
-	rows2, err := getTableRows(df.db2, tblName)
+	rows2, err := df.partitionRows(df.src2, tblName, partition)
 	if err != nil {
 		return false, errors.Trace(err)
 	}
 	defer rows2.Close()
 
-	cols1, err := rows1.ColumnTypes()
-	if err != nil {
-		return false, errors.Trace(err)
-	}
-	cols2, err := rows2.ColumnTypes()
-	if err != nil {
-		return false, errors.Trace(err)
+	return equalSourceRows(rows1, rows2, df.progress.table(tblName))
+}
+
+func (df *Diff) partitionRows(src RowSource, tblName string, partition string) (Rows, error) {
+	if len(partition) == 0 {
+		return df.rows(src, tblName)
 	}
-	if len(cols1) != len(cols2) {
-		return false, nil
+	ps, ok := asPartitionedSource(src)
+	if !ok {
+		return nil, errors.Errorf("can't read partition %s of table %s from the source", partition, tblName)
 	}
-
-	row1 := newRawBytesRow(cols1)
-	row2 := newRawBytesRow(cols2)
-	return equalRows(rows1, rows2, row1, row2)
+	return ps.partitionRows(tblName, partition)
 }
 
 func equalRows(rows1, rows2 *sql.Rows, row1, row2 comparableSQLRow) (bool, error) {
@@ -247,14 +559,24 @@ func equalOneRow(rows1, rows2 *sql.Rows, row1, row2 comparableSQLRow) (bool, err
 }
 
 func getTableRows(db *sql.DB, tblName string) (*sql.Rows, error) {
-	descs, err := getTableSchema(db, tblName)
+	return getPartitionRows(db, tblName, "")
+}
+
+// getPartitionRows selects the rows of one partition, or the whole table if partition is empty.
+func getPartitionRows(db *sql.DB, tblName string, partition string) (*sql.Rows, error) {
+	cols, err := getOrderByColumns(db, tblName)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	pk1 := orderbyKey(descs)
+	pk1 := orderbyKey(cols)
+
+	var partitionClause string
+	if len(partition) > 0 {
+		partitionClause = fmt.Sprintf(" partition (`%s`)", partition)
+	}
 
 	// TODO select all data out may OOM if table is huge
-	rows, err := querySQL(db, fmt.Sprintf("select * from `%s` order by %s", tblName, pk1))
+	rows, err := querySQL(db, fmt.Sprintf("select * from `%s`%s order by %s", tblName, partitionClause, pk1))
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -277,23 +599,10 @@ func getTableIndex(db *sql.DB, tblName string) (*sql.Rows, error) {
 	return rows, nil
 }
 
+// getTables returns the base tables, views and sequences are compared by their definition.
 func getTables(db *sql.DB) ([]string, error) {
-	rs, err := querySQL(db, "show tables;")
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	defer rs.Close()
-
-	var tbls []string
-	for rs.Next() {
-		var name string
-		err := rs.Scan(&name)
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-		tbls = append(tbls, name)
-	}
-	return tbls, nil
+	tbls, err := getTablesByType(db, "BASE TABLE")
+	return tbls, errors.Trace(err)
 }
 
 func getCreateTable(db *sql.DB, tn string) (string, error) {
@@ -330,13 +639,18 @@ type comparable interface {
 
 type rawBytesRow struct {
 	rawBytes []sql.RawBytes
-	colTypes []*sql.ColumnType
+	// typeNames is the database type name of each column
+	typeNames []string
 }
 
 func newRawBytesRow(colTypes []*sql.ColumnType) rawBytesRow {
+	typeNames := make([]string, len(colTypes))
+	for i, col := range colTypes {
+		typeNames[i] = col.DatabaseTypeName()
+	}
 	return rawBytesRow{
-		colTypes: colTypes,
-		rawBytes: make([]sql.RawBytes, len(colTypes)),
+		typeNames: typeNames,
+		rawBytes:  make([]sql.RawBytes, len(colTypes)),
 	}
 }
 
@@ -375,13 +689,16 @@ func equalJSON(data1 []byte, data2 []byte) bool {
 	// key-ordering and whitespace shouldn't matter
 	matched, err := matcher.Match(string(data2))
 	if err != nil {
-		log.Error(err, "data1: ", string(data1), " data2: ", string(data2))
+		// don't log the data, it may be sensitive
+		log.Error(err)
 		return false
 	}
 
 	return matched
 }
 
+// Equal compares the rows column by column, JSON ignoring key order and whitespace, the others as bytes.
+// NULL is different from the empty value, unlike comparing the bytes only.
 func (r rawBytesRow) Equal(data comparable) bool {
 	r2, ok := data.(rawBytesRow)
 	if !ok {
@@ -391,12 +708,17 @@ func (r rawBytesRow) Equal(data comparable) bool {
 		return false
 	}
 	for i := 0; i < r.Len(); i++ {
-		tname := r.colTypes[i].DatabaseTypeName()
+		tname := r.typeNames[i]
 		if len(tname) == 0 {
 			log.Warn("empty type name: ", tname)
 		}
 
-		if r.colTypes[i].DatabaseTypeName() == "JSON" {
+		// NULL is different from empty value
+		if (r.rawBytes[i] == nil) != (r2.rawBytes[i] == nil) {
+			return false
+		}
+
+		if tname == "JSON" {
 			if !equalJSON(r.rawBytes[i], r2.rawBytes[i]) {
 				return false
 			}
@@ -426,7 +748,13 @@ type showIndex struct {
 }
 
 func (si *showIndex) Scan(rows *sql.Rows) error {
-	err := rows.Scan(&si.Table,
+	// MySQL 8.0 and TiDB return more columns like Visible and Expression, ignore them
+	cols, err := rows.Columns()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	fields := []*sql.RawBytes{&si.Table,
 		&si.NonUnique,
 		&si.KeyName,
 		&si.SeqInIndex,
@@ -438,7 +766,17 @@ func (si *showIndex) Scan(rows *sql.Rows) error {
 		&si.Null,
 		&si.IndexType,
 		&si.Comment,
-		&si.IndexComment)
+		&si.IndexComment}
+	args := make([]interface{}, len(cols))
+	for i := range args {
+		if i < len(fields) {
+			args[i] = fields[i]
+		} else {
+			args[i] = new(sql.RawBytes)
+		}
+	}
+
+	err = rows.Scan(args...)
 	return errors.Trace(err)
 }
 
@@ -490,30 +828,13 @@ func getTableSchema(db *sql.DB, tblName string) ([]describeTable, error) {
 	return descs, err
 }
 
-func orderbyKey(descs []describeTable) string {
-	// TODO can't get the real primary key
+func orderbyKey(cols []string) string {
 	var buf bytes.Buffer
-	firstTime := true
-	for _, desc := range descs {
-		if desc.Key == "PRI" {
-			if firstTime {
-				fmt.Fprintf(&buf, "`%s`", desc.Field)
-				firstTime = false
-			} else {
-				fmt.Fprintf(&buf, ",`%s`", desc.Field)
-			}
-		}
-	}
-	if buf.Len() == 0 {
-		// if no primary key found, use all fields as order by key
-		for _, desc := range descs {
-			if firstTime {
-				fmt.Fprintf(&buf, "`%s`", desc.Field)
-				firstTime = false
-			} else {
-				fmt.Fprintf(&buf, ",`%s`", desc.Field)
-			}
+	for i, col := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
 		}
+		fmt.Fprintf(&buf, "`%s`", col)
 	}
 	return buf.String()
 }
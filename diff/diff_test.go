@@ -20,6 +20,10 @@ var _ = Suite(&testDBSuite{})
 
 var _ = Suite(&testEqualJSON{})
 
+var _ = Suite(&testRawBytesRow{})
+
+type testRawBytesRow struct{}
+
 type testEqualJSON struct{}
 
 type testDBSuite struct {
@@ -118,3 +122,24 @@ func (s *testEqualJSON) TestAll(c *C) {
 	match = equalJSON([]byte(""), []byte(""))
 	c.Assert(match, IsTrue)
 }
+
+func (s *testRawBytesRow) TestEqual(c *C) {
+	row := func(values ...sql.RawBytes) rawBytesRow {
+		return rawBytesRow{typeNames: []string{"BIGINT", "VARCHAR", "JSON"}, rawBytes: values}
+	}
+
+	c.Assert(row(sql.RawBytes("1"), sql.RawBytes("a"), nil).Equal(row(sql.RawBytes("1"), sql.RawBytes("a"), nil)), IsTrue)
+	c.Assert(row(sql.RawBytes("1"), sql.RawBytes("a"), nil).Equal(row(sql.RawBytes("1"), sql.RawBytes("b"), nil)), IsFalse)
+
+	// NULL is different from the empty value
+	c.Assert(row(sql.RawBytes("1"), nil, nil).Equal(row(sql.RawBytes("1"), sql.RawBytes{}, nil)), IsFalse)
+	c.Assert(row(sql.RawBytes("1"), sql.RawBytes{}, nil).Equal(row(sql.RawBytes("1"), nil, nil)), IsFalse)
+	c.Assert(row(sql.RawBytes("1"), nil, nil).Equal(row(sql.RawBytes("1"), nil, nil)), IsTrue)
+	c.Assert(row(sql.RawBytes("1"), sql.RawBytes{}, nil).Equal(row(sql.RawBytes("1"), sql.RawBytes{}, nil)), IsTrue)
+	c.Assert(row(sql.RawBytes("1"), sql.RawBytes("a"), nil).Equal(row(sql.RawBytes("1"), sql.RawBytes("a"), sql.RawBytes{})), IsFalse)
+
+	// JSON ignores key order and whitespace
+	c.Assert(row(sql.RawBytes("1"), nil, sql.RawBytes(`{"a": 1, "b": 2}`)).Equal(row(sql.RawBytes("1"), nil, sql.RawBytes(`{"b":2,"a":1}`))), IsTrue)
+
+	c.Assert(row(sql.RawBytes("1"), nil, nil).Equal(rawBytesRow{typeNames: []string{"BIGINT"}, rawBytes: []sql.RawBytes{sql.RawBytes("1")}}), IsFalse)
+}
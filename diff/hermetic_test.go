@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"database/sql"
+	"fmt"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testHermeticSuite{})
+
+// testHermeticSuite runs the diff against the in-process server, it always runs unlike testDBSuite.
+type testHermeticSuite struct {
+	ts *testServer
+}
+
+func (s *testHermeticSuite) SetUpSuite(c *C) {
+	s.ts = newTestServer(c)
+}
+
+func (s *testHermeticSuite) TearDownSuite(c *C) {
+	s.ts.close()
+}
+
+func (s *testHermeticSuite) TestEqual(c *C) {
+	schema := []string{
+		"create table t1(id bigint primary key, uk bigint unique key, v varchar(32), doc json)",
+		"create table t2(id bigint primary key, v bigint)",
+		"insert into t1 values(1, 1, 'a', '{\"a\": 1, \"b\": 2}'), (2, 2, null, null), (3, 3, '', '[]')",
+		"insert into t2 values(1, 1), (2, 2)",
+	}
+
+	cases := []struct {
+		name string
+		db1  []string
+		db2  []string
+		eq   bool
+		// the expect differences in the report
+		diffs []string
+	}{{
+		name: "same",
+		eq:   true,
+	}, {
+		name:  "missing table",
+		db1:   []string{"create table t3(id int primary key)"},
+		diffs: []string{"table t3: not exist in target"},
+	}, {
+		name:  "extra row",
+		db2:   []string{"insert into t2 values(3, 3)"},
+		diffs: []string{"table t2: different data"},
+	}, {
+		name:  "changed value",
+		db2:   []string{"update t1 set v = 'b' where id = 1"},
+		diffs: []string{"table t1: different data"},
+	}, {
+		name:  "null and empty value",
+		db2:   []string{"update t1 set v = '' where id = 2"},
+		diffs: []string{"table t1: different data"},
+	}, {
+		name: "json key order",
+		db2:  []string{"update t1 set doc = '{\"b\": 2, \"a\": 1}' where id = 1"},
+		eq:   true,
+	}, {
+		name:  "index difference",
+		db2:   []string{"create index idx_v on t2(v)"},
+		diffs: []string{"table t2: different index"},
+	}, {
+		name:  "schema difference",
+		db2:   []string{"alter table t2 add column c int"},
+		diffs: []string{"table t2: different schema"},
+	}, {
+		name: "no primary key duplicates",
+		db1: []string{
+			"create table t3(a int, b int)",
+			"insert into t3 values(1, 1), (1, 1), (2, 2)",
+		},
+		db2: []string{
+			"create table t3(a int, b int)",
+			"insert into t3 values(2, 2), (1, 1)",
+		},
+		diffs: []string{"table t3: different data"},
+	}, {
+		name: "no primary key same duplicates",
+		db1: []string{
+			"create table t3(a int, b int)",
+			"insert into t3 values(1, 1), (1, 1), (2, 2)",
+		},
+		db2: []string{
+			"create table t3(a int, b int)",
+			"insert into t3 values(2, 2), (1, 1), (1, 1)",
+		},
+		eq: true,
+	}, {
+		name:  "view difference",
+		db1:   []string{"create view v1 as select id from t1"},
+		db2:   []string{"create view v1 as select id, v from t1"},
+		diffs: []string{"view v1: different definition"},
+	}}
+
+	for _, cs := range cases {
+		comment := Commentf("case: %s", cs.name)
+
+		db1 := s.ts.resetDB(c, "db1", append(schema, cs.db1...)...)
+		db2 := s.ts.resetDB(c, "db2", append(schema, cs.db2...)...)
+
+		df := New(nil, db1, db2)
+		eq, err := df.Equal()
+		c.Assert(err, IsNil, comment)
+		c.Assert(eq, Equals, cs.eq, comment)
+
+		report, err := df.Report()
+		c.Assert(err, IsNil, comment)
+		c.Assert(report.Equal(), Equals, cs.eq, comment)
+		var diffs []string
+		for _, d := range report.Differences {
+			diffs = append(diffs, fmt.Sprintf("%s %s: %s", d.Object, d.Name, d.Reason))
+		}
+		c.Assert(diffs, DeepEquals, cs.diffs, comment)
+
+		db1.Close()
+		db2.Close()
+	}
+}
+
+func (s *testHermeticSuite) TestSampleRows(c *C) {
+	schema := []string{
+		"create table t(id bigint primary key, email varchar(32), v bigint)",
+		"insert into t values(1, 'a@x.com', 1), (2, 'b@x.com', 2), (3, 'c@x.com', 3), (5, 'e@x.com', 5)",
+	}
+	db1 := s.ts.resetDB(c, "db1", schema...)
+	defer db1.Close()
+	db2 := s.ts.resetDB(c, "db2", append(schema,
+		"update t set email = 'z@x.com' where id = 1",
+		"delete from t where id = 3",
+		"insert into t values(4, 'd@x.com', 4)",
+		"update t set v = 0 where id = 5",
+	)...)
+	defer db2.Close()
+
+	cfg := *defaultConfig
+	cfg.MaxSampleRows = 3
+	cfg.Redact = RedactConfig{Columns: map[string][]string{"t": {"email"}}}
+	report, err := New(&cfg, db1, db2).Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Differences, HasLen, 1)
+	c.Assert(report.Differences[0].Rows, DeepEquals, []RowSample{
+		{Key: "`id`=1", Source: "`id`=1, `email`=***, `v`=1", Target: "`id`=1, `email`=***, `v`=1"},
+		{Key: "`id`=3", Source: "`id`=3, `email`=***, `v`=3"},
+		{Key: "`id`=4", Target: "`id`=4, `email`=***, `v`=4"},
+	})
+	c.Assert(report.String(), Not(Matches), "(?s).*@x.com.*")
+
+	cfg.MaxSampleRows = 0
+	report, err = New(&cfg, db1, db2).Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Differences, HasLen, 1)
+	c.Assert(report.Differences[0].Rows, HasLen, 0)
+
+	// the rows are matched by the binary keys, not ordered by the case insensitive collation
+	schema = []string{"create table t(k varchar(32) collate utf8mb4_0900_ai_ci primary key, v bigint)"}
+	db1 = s.ts.resetDB(c, "db1", append(schema, "insert into t values('a', 1), ('B', 2)")...)
+	defer db1.Close()
+	db2 = s.ts.resetDB(c, "db2", append(schema, "insert into t values('B', 3)")...)
+	defer db2.Close()
+	report, err = New(nil, db1, db2).Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Differences, HasLen, 1)
+	c.Assert(report.Differences[0].Rows, DeepEquals, []RowSample{
+		{Key: "`k`=B", Source: "`k`=B, `v`=2", Target: "`k`=B, `v`=3"},
+		{Key: "`k`=a", Source: "`k`=a, `v`=1"},
+	})
+}
+
+func (s *testHermeticSuite) TestTableOptions(c *C) {
+	schema := []string{
+		"create table t(id bigint auto_increment primary key, v bigint) comment='t'",
+		"insert into t values(1, 1), (2, 2)",
+	}
+
+	cases := []struct {
+		name string
+		db1  []string
+		db2  []string
+		eq   bool
+	}{{
+		name: "same",
+		eq:   true,
+	}, {
+		name: "target ahead",
+		db2:  []string{"alter table t auto_increment = 100"},
+		eq:   true,
+	}, {
+		name: "target behind",
+		db1:  []string{"alter table t auto_increment = 100"},
+	}, {
+		name: "different comment",
+		db2: []string{
+			"drop table t",
+			"create table t(id bigint auto_increment primary key, v bigint) comment='x'",
+			"insert into t values(1, 1), (2, 2)",
+		},
+	}}
+
+	cfg := *defaultConfig
+	cfg.EqualTableOptions = true
+	for _, cs := range cases {
+		comment := Commentf("case: %s", cs.name)
+
+		db1 := s.ts.resetDB(c, "db1", append(schema, cs.db1...)...)
+		db2 := s.ts.resetDB(c, "db2", append(schema, cs.db2...)...)
+
+		df := New(&cfg, db1, db2)
+		eq, err := df.Equal()
+		c.Assert(err, IsNil, comment)
+		c.Assert(eq, Equals, cs.eq, comment)
+
+		report, err := df.Report()
+		c.Assert(err, IsNil, comment)
+		if cs.eq {
+			c.Assert(report.Differences, HasLen, 0, comment)
+		} else {
+			c.Assert(report.Differences, HasLen, 1, comment)
+			c.Assert(report.Differences[0].Reason, Equals, "different table options", comment)
+		}
+
+		// the options are not compared by default
+		eq, err = New(nil, db1, db2).Equal()
+		c.Assert(err, IsNil, comment)
+		c.Assert(eq, IsTrue, comment)
+
+		db1.Close()
+		db2.Close()
+	}
+}
+
+func (s *testHermeticSuite) TestMultiDiff(c *C) {
+	schema := []string{
+		"create table t(id bigint primary key, v bigint)",
+		"insert into t values(1, 1), (2, 2), (10, 10)",
+	}
+
+	var dbs []*sql.DB
+	for i := 0; i < 3; i++ {
+		db := s.ts.resetDB(c, fmt.Sprintf("db%d", i), schema...)
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+
+	mismatches, err := NewMulti(nil, dbs...).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(mismatches, HasLen, 0)
+
+	// db1 diverged
+	_, err = dbs[1].Exec("update t set v = 0 where id = 2")
+	c.Assert(err, IsNil)
+	_, err = dbs[1].Exec("insert into t values(9, 9)")
+	c.Assert(err, IsNil)
+
+	mismatches, err = NewMulti(nil, dbs...).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(mismatches, HasLen, 1)
+	c.Assert(mismatches[0].Table, Equals, "t")
+	c.Assert(mismatches[0].Minority(), DeepEquals, []int{1})
+	c.Assert(mismatches[0].Rows, DeepEquals, []RowMismatch{
+		{Key: "`id`=2", Groups: Groups{{0, 2}, {1}}},
+		{Key: "`id`=9", Groups: Groups{{0, 2}, {1}}},
+	})
+	c.Assert(mismatches[0].RowCount, Equals, 2)
+
+	// only the first rows are kept
+	cfg := *defaultConfig
+	cfg.MaxMismatchRows = 1
+	mismatches, err = NewMulti(&cfg, dbs...).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(mismatches, HasLen, 1)
+	c.Assert(mismatches[0].Rows, DeepEquals, []RowMismatch{{Key: "`id`=2", Groups: Groups{{0, 2}, {1}}}})
+	c.Assert(mismatches[0].RowCount, Equals, 2)
+}
+
+func (s *testHermeticSuite) TestMultiDiffCaseInsensitiveKey(c *C) {
+	// 'B' < 'a' as binary but 'a' < 'B' in the case-insensitive collation
+	schema := []string{
+		"create table t(k varchar(32) collate utf8mb4_0900_ai_ci primary key, v bigint)",
+		"insert into t values('B', 2)",
+	}
+
+	var dbs []*sql.DB
+	for i := 0; i < 3; i++ {
+		db := s.ts.resetDB(c, fmt.Sprintf("db%d", i), schema...)
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	_, err := dbs[0].Exec("insert into t values('a', 1)")
+	c.Assert(err, IsNil)
+
+	mismatches, err := NewMulti(nil, dbs...).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(mismatches, HasLen, 1)
+	c.Assert(mismatches[0].Rows, DeepEquals, []RowMismatch{{Key: "`k`=a", Groups: Groups{{1, 2}, {0}}}})
+}
@@ -0,0 +1,97 @@
+package diff
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/pingcap/errors"
+)
+
+// indexInfo is an index of table read from information_schema.STATISTICS.
+type indexInfo struct {
+	Name    string
+	Unique  bool
+	Columns []string
+	// Nullable is true if any column of the index is nullable or the index contains an expression.
+	Nullable bool
+}
+
+func getIndexes(db *sql.DB, tblName string) ([]*indexInfo, error) {
+	rows, err := db.Query("select INDEX_NAME, NON_UNIQUE, COLUMN_NAME, NULLABLE from information_schema.STATISTICS "+
+		"where TABLE_SCHEMA = database() and TABLE_NAME = ? order by INDEX_NAME, SEQ_IN_INDEX", tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var indexes []*indexInfo
+	for rows.Next() {
+		var (
+			name      string
+			nonUnique int
+			column    sql.NullString
+			nullable  sql.NullString
+		)
+		err := rows.Scan(&name, &nonUnique, &column, &nullable)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, &indexInfo{Name: name, Unique: nonUnique == 0})
+		}
+		index := indexes[len(indexes)-1]
+		index.Columns = append(index.Columns, column.String)
+		// the column name is NULL for the expression index
+		if !column.Valid || nullable.String == "YES" {
+			index.Nullable = true
+		}
+	}
+	return indexes, errors.Trace(rows.Err())
+}
+
+// chooseOrderByKey returns the columns to order the rows by: the primary key, or else the unique key
+// with the fewest columns all not null, or else all the columns.
+//
+// A table without such key in TiDB is non-clustered and its rows are identified by the hidden _tidb_rowid,
+// which is allocated by each cluster independently, so we never order by it and use all the columns instead.
+// The primary key is used no matter the table is clustered or not, it identifies the row in both cases.
+func chooseOrderByKey(indexes []*indexInfo, descs []describeTable) []string {
+	var uniques []*indexInfo
+	for _, index := range indexes {
+		if index.Name == "PRIMARY" {
+			return index.Columns
+		}
+		if index.Unique && !index.Nullable {
+			uniques = append(uniques, index)
+		}
+	}
+
+	if len(uniques) > 0 {
+		sort.SliceStable(uniques, func(i, j int) bool {
+			return len(uniques[i].Columns) < len(uniques[j].Columns)
+		})
+		return uniques[0].Columns
+	}
+
+	cols := make([]string, 0, len(descs))
+	for _, desc := range descs {
+		cols = append(cols, desc.Field)
+	}
+	return cols
+}
+
+// getOrderByColumns returns the columns to order the rows of the table by, see chooseOrderByKey.
+func getOrderByColumns(db *sql.DB, tblName string) ([]string, error) {
+	indexes, err := getIndexes(db, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	descs, err := getTableSchema(db, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return chooseOrderByKey(indexes, descs), nil
+}
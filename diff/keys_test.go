@@ -0,0 +1,36 @@
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testKeysSuite{})
+
+type testKeysSuite struct{}
+
+func (s *testKeysSuite) TestChooseOrderByKey(c *C) {
+	descs := []describeTable{{Field: "a"}, {Field: "b"}, {Field: "c"}}
+
+	// composite primary key keeps the order in the index
+	indexes := []*indexInfo{
+		{Name: "PRIMARY", Unique: true, Columns: []string{"c", "a"}},
+		{Name: "uk", Unique: true, Columns: []string{"b"}},
+	}
+	c.Assert(chooseOrderByKey(indexes, descs), DeepEquals, []string{"c", "a"})
+
+	// the not null unique key with fewest columns
+	indexes = []*indexInfo{
+		{Name: "idx", Unique: false, Columns: []string{"a"}},
+		{Name: "uk1", Unique: true, Columns: []string{"b", "c"}},
+		{Name: "uk2", Unique: true, Columns: []string{"a"}, Nullable: true},
+		{Name: "uk3", Unique: true, Columns: []string{"c"}},
+	}
+	c.Assert(chooseOrderByKey(indexes, descs), DeepEquals, []string{"c"})
+
+	// no primary key or not null unique key
+	indexes = []*indexInfo{
+		{Name: "uk", Unique: true, Columns: []string{"a"}, Nullable: true},
+	}
+	c.Assert(chooseOrderByKey(indexes, descs), DeepEquals, []string{"a", "b", "c"})
+	c.Assert(chooseOrderByKey(nil, descs), DeepEquals, []string{"a", "b", "c"})
+}
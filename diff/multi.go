@@ -0,0 +1,422 @@
+package diff
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+)
+
+// MultiDiff contains N sql DB, used for finding out which one diverges from the others.
+type MultiDiff struct {
+	cfg *Config
+	dbs []*sql.DB
+}
+
+// NewMulti returns a MultiDiff instance.
+func NewMulti(cfg *Config, dbs ...*sql.DB) *MultiDiff {
+	if cfg == nil {
+		cfg = defaultConfig
+	}
+	return &MultiDiff{
+		cfg: cfg,
+		dbs: dbs,
+	}
+}
+
+// Groups is the index of databases grouped by having identical version of something,
+// the biggest group comes first.
+type Groups [][]int
+
+// Minority returns the index of databases not in the biggest group,
+// it returns nil if there's no single biggest group.
+func (g Groups) Minority() []int {
+	if len(g) <= 1 {
+		return nil
+	}
+	if len(g[0]) == len(g[1]) {
+		return nil
+	}
+
+	var minority []int
+	for _, group := range g[1:] {
+		minority = append(minority, group...)
+	}
+	sort.Ints(minority)
+	return minority
+}
+
+// RowMismatch is a row having different versions across the databases.
+type RowMismatch struct {
+	// Key is the order by key of the row, like "`id`=1".
+	Key    string
+	Groups Groups
+}
+
+// TableMismatch is a table having different versions across the databases.
+type TableMismatch struct {
+	Table string
+	// Groups group the databases by the table existence or schema,
+	// it contains only one group if the table differs by rows only.
+	Groups Groups
+	// Rows are the first cfg.MaxMismatchRows different rows.
+	Rows []RowMismatch
+	// RowCount is the number of all the different rows.
+	RowCount int
+}
+
+// Minority returns the index of databases in the minority of the table or any row of the table.
+func (tm *TableMismatch) Minority() []int {
+	seen := make(map[int]struct{})
+	var minority []int
+	add := func(idxs []int) {
+		for _, idx := range idxs {
+			if _, ok := seen[idx]; !ok {
+				seen[idx] = struct{}{}
+				minority = append(minority, idx)
+			}
+		}
+	}
+
+	add(tm.Groups.Minority())
+	for _, row := range tm.Rows {
+		add(row.Groups.Minority())
+	}
+	sort.Ints(minority)
+	return minority
+}
+
+// Equal compares all the tables across the databases and returns the mismatched tables.
+func (md *MultiDiff) Equal() ([]*TableMismatch, error) {
+	present := make(map[string][]bool)
+	var names []string
+	for i, db := range md.dbs {
+		tbls, err := getTables(db)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, tbl := range tbls {
+			if _, ok := present[tbl]; !ok {
+				present[tbl] = make([]bool, len(md.dbs))
+				names = append(names, tbl)
+			}
+			present[tbl][i] = true
+		}
+	}
+	sort.Strings(names)
+
+	var mismatches []*TableMismatch
+	for _, tbl := range names {
+		groups := groupBy(len(md.dbs), func(i, j int) bool {
+			return present[tbl][i] == present[tbl][j]
+		})
+		if len(groups) > 1 {
+			log.Infof("table %s not exists in all databases, groups: %v", tbl, groups)
+			mismatches = append(mismatches, &TableMismatch{Table: tbl, Groups: groups})
+			continue
+		}
+
+		tm, err := md.EqualTable(tbl)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if tm != nil {
+			mismatches = append(mismatches, tm)
+		}
+	}
+
+	return mismatches, nil
+}
+
+// EqualTable compares the table across the databases, it returns nil if all the databases have the same data.
+func (md *MultiDiff) EqualTable(tblName string) (*TableMismatch, error) {
+	n := len(md.dbs)
+	streams := make([]*rowStream, n)
+	defer func() {
+		for _, s := range streams {
+			if s != nil {
+				s.rows.Close()
+			}
+		}
+	}()
+
+	for i, db := range md.dbs {
+		s, err := newRowStream(db, tblName)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		streams[i] = s
+	}
+
+	groups := groupBy(n, func(i, j int) bool {
+		return equalStrings(streams[i].colNames, streams[j].colNames) &&
+			equalStrings(streams[i].keyNames, streams[j].keyNames)
+	})
+	if len(groups) > 1 {
+		log.Infof("table %s have different schema, groups: %v", tblName, groups)
+		return &TableMismatch{Table: tblName, Groups: groups}, nil
+	}
+
+	if !md.cfg.EqualData {
+		return nil, nil
+	}
+
+	for _, s := range streams {
+		if err := s.next(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var rowMismatches []RowMismatch
+	var rowCount int
+	for {
+		// find out the smallest key of the current rows
+		var minRow []sql.RawBytes
+		minIdx := -1
+		for i, s := range streams {
+			if s.cur == nil {
+				continue
+			}
+			if minIdx == -1 || s.compareKey(s.cur, minRow) < 0 {
+				minIdx = i
+				minRow = s.cur
+			}
+		}
+		if minIdx == -1 {
+			break
+		}
+
+		// the current row of streams not having the smallest key is absent for this key
+		versions := make([][]sql.RawBytes, n)
+		for i, s := range streams {
+			if s.cur != nil && s.compareKey(s.cur, minRow) == 0 {
+				versions[i] = s.cur
+			}
+		}
+
+		groups := groupBy(n, func(i, j int) bool {
+			if versions[i] == nil || versions[j] == nil {
+				return versions[i] == nil && versions[j] == nil
+			}
+			return streams[i].equalRow(versions[i], versions[j])
+		})
+		if len(groups) > 1 {
+			rowCount++
+			if len(rowMismatches) < md.cfg.MaxMismatchRows {
+				rowMismatches = append(rowMismatches, RowMismatch{
+					Key:    md.cfg.Redact.formatRow(tblName, streams[minIdx].colNames, streams[minIdx].keyIdxs, minRow),
+					Groups: groups,
+				})
+			}
+		}
+
+		for i, s := range streams {
+			if versions[i] != nil {
+				if err := s.next(); err != nil {
+					return nil, errors.Trace(err)
+				}
+			}
+		}
+	}
+
+	if rowCount == 0 {
+		return nil, nil
+	}
+
+	log.Infof("table %s have %d different rows", tblName, rowCount)
+	return &TableMismatch{
+		Table:    tblName,
+		Groups:   Groups{allIndexes(n)},
+		Rows:     rowMismatches,
+		RowCount: rowCount,
+	}, nil
+}
+
+// rowStream iterates the rows of a table ordered by the order by key.
+type rowStream struct {
+	rows     *sql.Rows
+	row      rawBytesRow
+	colNames []string
+	keyNames []string
+	keyIdxs  []int
+	// cur is a copy of the current row, nil if exhausted
+	cur []sql.RawBytes
+}
+
+func newRowStream(db *sql.DB, tblName string) (*rowStream, error) {
+	keyNames, err := getOrderByColumns(db, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	query, err := selectBinaryOrderedSQL(db, tblName, keyNames)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rows, err := querySQL(db, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, errors.Trace(err)
+	}
+
+	s := &rowStream{
+		rows:     rows,
+		row:      newRawBytesRow(colTypes),
+		keyNames: keyNames,
+	}
+	for _, col := range colTypes {
+		s.colNames = append(s.colNames, col.Name())
+	}
+	for _, key := range s.keyNames {
+		for i, name := range s.colNames {
+			if name == key {
+				s.keyIdxs = append(s.keyIdxs, i)
+				break
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// selectBinaryOrderedSQL returns the sql to select all the rows of the table ordered by the keys, the keys not
+// numeric are ordered as binary like compareValue does, whatever the collation of the column is.
+func selectBinaryOrderedSQL(db *sql.DB, tblName string, keyNames []string) (string, error) {
+	rows, err := querySQL(db, fmt.Sprintf("select * from `%s` limit 0", tblName))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	typeNames := make(map[string]string, len(colTypes))
+	for _, col := range colTypes {
+		typeNames[col.Name()] = col.DatabaseTypeName()
+	}
+	keys := make([]string, 0, len(keyNames))
+	for _, key := range keyNames {
+		if isNumericType(typeNames[key]) {
+			keys = append(keys, fmt.Sprintf("`%s`", key))
+		} else {
+			keys = append(keys, fmt.Sprintf("binary `%s`", key))
+		}
+	}
+	return fmt.Sprintf("select * from `%s` order by %s", tblName, strings.Join(keys, ",")), nil
+}
+
+func (s *rowStream) next() error {
+	if !s.rows.Next() {
+		s.cur = nil
+		return errors.Trace(s.rows.Err())
+	}
+
+	err := s.row.Scan(s.rows)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// the sql.RawBytes is only valid until the next call of Next, so copy it
+	s.cur = copyRow(s.row.rawBytes)
+	return nil
+}
+
+func (s *rowStream) equalRow(r1, r2 []sql.RawBytes) bool {
+	return rawBytesRow{typeNames: s.row.typeNames, rawBytes: r1}.Equal(
+		rawBytesRow{typeNames: s.row.typeNames, rawBytes: r2})
+}
+
+func (s *rowStream) compareKey(r1, r2 []sql.RawBytes) int {
+	for _, idx := range s.keyIdxs {
+		c := compareValue(s.row.typeNames[idx], r1[idx], r2[idx])
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// copyRow returns a copy of the row keeping NULL different from the empty value.
+func copyRow(row []sql.RawBytes) []sql.RawBytes {
+	cp := make([]sql.RawBytes, len(row))
+	for i, b := range row {
+		if b != nil {
+			cp[i] = append(sql.RawBytes{}, b...)
+		}
+	}
+	return cp
+}
+
+// compareValue compares two values the same way as the database order them, NULL is the smallest.
+// The values not numeric are compared as binary, so the rows are selected ordered by binary keys.
+func compareValue(typeName string, v1, v2 sql.RawBytes) int {
+	switch {
+	case v1 == nil && v2 == nil:
+		return 0
+	case v1 == nil:
+		return -1
+	case v2 == nil:
+		return 1
+	}
+
+	if isNumericType(typeName) {
+		r1, ok1 := new(big.Rat).SetString(string(v1))
+		r2, ok2 := new(big.Rat).SetString(string(v2))
+		if ok1 && ok2 {
+			return r1.Cmp(r2)
+		}
+	}
+
+	return bytes.Compare(v1, v2)
+}
+
+func isNumericType(typeName string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return true
+	}
+	return false
+}
+
+// groupBy groups the index [0, n) by the equal function, the biggest group comes first.
+func groupBy(n int, equal func(i, j int) bool) Groups {
+	var groups Groups
+	for i := 0; i < n; i++ {
+		found := false
+		for g, group := range groups {
+			if equal(group[0], i) {
+				groups[g] = append(group, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []int{i})
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i]) > len(groups[j])
+	})
+	return groups
+}
+
+func allIndexes(n int) []int {
+	idxs := make([]int, n)
+	for i := range idxs {
+		idxs[i] = i
+	}
+	return idxs
+}
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testMultiSuite{})
+
+type testMultiSuite struct{}
+
+func (s *testMultiSuite) TestGroupBy(c *C) {
+	versions := []string{"a", "b", "a", "a", "c"}
+	groups := groupBy(len(versions), func(i, j int) bool {
+		return versions[i] == versions[j]
+	})
+	c.Assert(groups, DeepEquals, Groups{{0, 2, 3}, {1}, {4}})
+	c.Assert(groups.Minority(), DeepEquals, []int{1, 4})
+
+	// no single biggest group
+	versions = []string{"a", "b", "a", "b"}
+	groups = groupBy(len(versions), func(i, j int) bool {
+		return versions[i] == versions[j]
+	})
+	c.Assert(groups, DeepEquals, Groups{{0, 2}, {1, 3}})
+	c.Assert(groups.Minority(), IsNil)
+
+	c.Assert(Groups{{0, 1, 2}}.Minority(), IsNil)
+}
+
+func (s *testMultiSuite) TestTableMismatchMinority(c *C) {
+	tm := &TableMismatch{
+		Table:  "t",
+		Groups: Groups{{0, 1, 2}},
+		Rows: []RowMismatch{
+			{Key: "`id`=1", Groups: Groups{{0, 1}, {2}}},
+			{Key: "`id`=2", Groups: Groups{{1, 2}, {0}}},
+			{Key: "`id`=3", Groups: Groups{{0, 2}, {1}}},
+			{Key: "`id`=4", Groups: Groups{{0, 1}, {2}}},
+		},
+	}
+	c.Assert(tm.Minority(), DeepEquals, []int{0, 1, 2})
+}
+
+func (s *testMultiSuite) TestCompareValue(c *C) {
+	c.Assert(compareValue("BIGINT", []byte("9"), []byte("10")), Equals, -1)
+	c.Assert(compareValue("UNSIGNED BIGINT", []byte("9"), []byte("18446744073709551615")), Equals, -1)
+	c.Assert(compareValue("BIGINT", []byte("-1"), []byte("-10")), Equals, 1)
+	c.Assert(compareValue("DECIMAL", []byte("1.50"), []byte("1.5")), Equals, 0)
+	c.Assert(compareValue("VARCHAR", []byte("9"), []byte("10")), Equals, 1)
+	c.Assert(compareValue("INT", nil, []byte("0")), Equals, -1)
+	c.Assert(compareValue("INT", nil, nil), Equals, 0)
+}
@@ -0,0 +1,301 @@
+package diff
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+)
+
+// objectDefs maps the name of objects to the normalized definition.
+type objectDefs map[string]string
+
+type objectLoader struct {
+	object ObjectType
+	load   func(db *sql.DB) (objectDefs, error)
+}
+
+func (df *Diff) objectLoaders() []objectLoader {
+	var loaders []objectLoader
+	if df.cfg.EqualViews {
+		loaders = append(loaders, objectLoader{ObjectView, getViews})
+	}
+	if df.cfg.EqualTriggers {
+		loaders = append(loaders, objectLoader{ObjectTrigger, getTriggers})
+	}
+	if df.cfg.EqualRoutines {
+		loaders = append(loaders, objectLoader{ObjectRoutine, getRoutines})
+	}
+	if df.cfg.EqualSequences {
+		loaders = append(loaders, objectLoader{ObjectSequence, getSequences})
+	}
+	if df.cfg.EqualUsers {
+		loaders = append(loaders, objectLoader{ObjectUser, getUsers})
+	}
+	return loaders
+}
+
+// diffObjects compares the definition of the objects other than base table.
+func (df *Diff) diffObjects(report *Report) error {
+	if !df.bothDB() {
+		return nil
+	}
+
+	for _, loader := range df.objectLoaders() {
+		defs1, err := loader.load(df.db1)
+		if err != nil {
+			return errors.Annotatef(err, "load %s of source db", loader.object)
+		}
+		defs2, err := loader.load(df.db2)
+		if err != nil {
+			return errors.Annotatef(err, "load %s of target db", loader.object)
+		}
+
+		for _, d := range compareObjectDefs(loader.object, defs1, defs2) {
+			log.Infof("object different: %s", d)
+			report.add(d)
+		}
+	}
+	return nil
+}
+
+func compareObjectDefs(object ObjectType, defs1, defs2 objectDefs) []*Difference {
+	names := make([]string, 0, len(defs1)+len(defs2))
+	for name := range defs1 {
+		names = append(names, name)
+	}
+	for name := range defs2 {
+		if _, ok := defs1[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []*Difference
+	for _, name := range names {
+		def1, ok1 := defs1[name]
+		def2, ok2 := defs2[name]
+		switch {
+		case !ok2:
+			diffs = append(diffs, &Difference{Object: object, Name: name, Reason: "not exist in target", Source: def1})
+		case !ok1:
+			diffs = append(diffs, &Difference{Object: object, Name: name, Reason: "not exist in source", Target: def2})
+		case def1 != def2:
+			diffs = append(diffs, &Difference{Object: object, Name: name, Reason: "different definition", Source: def1, Target: def2})
+		}
+	}
+	return diffs
+}
+
+var (
+	definerRegexp    = regexp.MustCompile("(?i)\\s*DEFINER\\s*=\\s*(`[^`]*`|'[^']*'|\\S+)@(`[^`]*`|'[^']*'|\\S+)")
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+// normalizeDefinition removes the definer and redundant whitespace from a definition,
+// the definer is not replicated the same way by every tool.
+func normalizeDefinition(def string) string {
+	def = definerRegexp.ReplaceAllString(def, "")
+	def = whitespaceRegexp.ReplaceAllString(def, " ")
+	return strings.TrimSpace(def)
+}
+
+func getTablesByType(db *sql.DB, tableType string) ([]string, error) {
+	rs, err := querySQL(db, fmt.Sprintf("show full tables where Table_type = '%s';", tableType))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+
+	var tbls []string
+	for rs.Next() {
+		var name, typ string
+		err := rs.Scan(&name, &typ)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		tbls = append(tbls, name)
+	}
+	return tbls, errors.Trace(rs.Err())
+}
+
+// queryColumn returns the column of index idx in the first row of query, the other columns are ignored.
+func queryColumn(db *sql.DB, query string, idx int) (string, error) {
+	rs, err := querySQL(db, query)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer rs.Close()
+
+	cols, err := rs.Columns()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if idx >= len(cols) {
+		return "", errors.Errorf("query %s returns %d columns, want column %d", query, len(cols), idx)
+	}
+
+	if !rs.Next() {
+		return "", errors.NotFoundf("result of query %s", query)
+	}
+	values := make([]sql.RawBytes, len(cols))
+	args := make([]interface{}, len(cols))
+	for i := range values {
+		args[i] = &values[i]
+	}
+	err = rs.Scan(args...)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return string(values[idx]), nil
+}
+
+func getViews(db *sql.DB) (objectDefs, error) {
+	views, err := getTablesByType(db, "VIEW")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	defs := make(objectDefs, len(views))
+	for _, view := range views {
+		def, err := queryColumn(db, fmt.Sprintf("show create view `%s`;", view), 1)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defs[view] = normalizeDefinition(def)
+	}
+	return defs, nil
+}
+
+func getSequences(db *sql.DB) (objectDefs, error) {
+	seqs, err := getTablesByType(db, "SEQUENCE")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	defs := make(objectDefs, len(seqs))
+	for _, seq := range seqs {
+		def, err := queryColumn(db, fmt.Sprintf("show create sequence `%s`;", seq), 1)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defs[seq] = normalizeDefinition(def)
+	}
+	return defs, nil
+}
+
+func getTriggers(db *sql.DB) (objectDefs, error) {
+	rs, err := querySQL(db, "select TRIGGER_NAME, ACTION_TIMING, EVENT_MANIPULATION, EVENT_OBJECT_TABLE, ACTION_ORIENTATION, ACTION_STATEMENT "+
+		"from information_schema.TRIGGERS where TRIGGER_SCHEMA = database();")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+
+	defs := make(objectDefs)
+	for rs.Next() {
+		var name, timing, event, table, orientation, stmt string
+		err := rs.Scan(&name, &timing, &event, &table, &orientation, &stmt)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defs[name] = normalizeDefinition(fmt.Sprintf("%s %s ON `%s` FOR EACH %s %s", timing, event, table, orientation, stmt))
+	}
+	return defs, errors.Trace(rs.Err())
+}
+
+func getRoutines(db *sql.DB) (objectDefs, error) {
+	rs, err := querySQL(db, "select ROUTINE_NAME, ROUTINE_TYPE from information_schema.ROUTINES where ROUTINE_SCHEMA = database();")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+
+	type routine struct {
+		name string
+		typ  string
+	}
+	var routines []routine
+	for rs.Next() {
+		var r routine
+		err := rs.Scan(&r.name, &r.typ)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		routines = append(routines, r)
+	}
+	if err := rs.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	defs := make(objectDefs, len(routines))
+	for _, r := range routines {
+		def, err := queryColumn(db, fmt.Sprintf("show create %s `%s`;", strings.ToLower(r.typ), r.name), 2)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// procedure and function live in different namespace
+		defs[r.typ+" "+r.name] = normalizeDefinition(def)
+	}
+	return defs, nil
+}
+
+func getUsers(db *sql.DB) (objectDefs, error) {
+	rs, err := querySQL(db, "select User, Host from mysql.user;")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+
+	var users [][2]string
+	for rs.Next() {
+		var user, host string
+		err := rs.Scan(&user, &host)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		users = append(users, [2]string{user, host})
+	}
+	if err := rs.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	defs := make(objectDefs, len(users))
+	for _, u := range users {
+		grants, err := getGrants(db, u[0], u[1])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defs[fmt.Sprintf("'%s'@'%s'", u[0], u[1])] = strings.Join(grants, "; ")
+	}
+	return defs, nil
+}
+
+// getGrants returns the sorted and normalized grants of the user.
+func getGrants(db *sql.DB, user string, host string) ([]string, error) {
+	rs, err := querySQL(db, fmt.Sprintf("show grants for '%s'@'%s';", escapeString(user), escapeString(host)))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rs.Close()
+
+	var grants []string
+	for rs.Next() {
+		var grant string
+		err := rs.Scan(&grant)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		grants = append(grants, normalizeDefinition(grant))
+	}
+	sort.Strings(grants)
+	return grants, errors.Trace(rs.Err())
+}
+
+func escapeString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -0,0 +1,31 @@
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testObjectSuite{})
+
+type testObjectSuite struct{}
+
+func (s *testObjectSuite) TestNormalizeDefinition(c *C) {
+	def1 := "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v1`  AS\n SELECT `id` FROM `t1`"
+	def2 := "CREATE ALGORITHM=UNDEFINED DEFINER=`admin`@`127.0.0.1` SQL SECURITY DEFINER VIEW `v1` AS SELECT `id` FROM `t1`"
+	c.Assert(normalizeDefinition(def1), Equals, "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `v1` AS SELECT `id` FROM `t1`")
+	c.Assert(normalizeDefinition(def1), Equals, normalizeDefinition(def2))
+
+	c.Assert(normalizeDefinition("CREATE DEFINER='root'@'localhost' PROCEDURE `p`()"), Equals, "CREATE PROCEDURE `p`()")
+}
+
+func (s *testObjectSuite) TestCompareObjectDefs(c *C) {
+	defs1 := objectDefs{"v1": "a", "v2": "b", "v3": "c"}
+	defs2 := objectDefs{"v1": "a", "v2": "x", "v4": "d"}
+
+	diffs := compareObjectDefs(ObjectView, defs1, defs2)
+	c.Assert(diffs, HasLen, 3)
+	c.Assert(*diffs[0], DeepEquals, Difference{Object: ObjectView, Name: "v2", Reason: "different definition", Source: "b", Target: "x"})
+	c.Assert(*diffs[1], DeepEquals, Difference{Object: ObjectView, Name: "v3", Reason: "not exist in target", Source: "c"})
+	c.Assert(*diffs[2], DeepEquals, Difference{Object: ObjectView, Name: "v4", Reason: "not exist in source", Target: "d"})
+
+	c.Assert(compareObjectDefs(ObjectView, defs1, defs1), HasLen, 0)
+}
@@ -0,0 +1,119 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// tableOptions is the metadata of a table related to id allocation, parsed from SHOW CREATE TABLE.
+type tableOptions struct {
+	// AutoIncrement is the next auto increment id, 0 if the table doesn't show it.
+	AutoIncrement  uint64
+	AutoIDCache    string
+	ShardRowIDBits string
+	// AutoRandom are the AUTO_RANDOM columns like "`id` AUTO_RANDOM(5)" in order.
+	AutoRandom []string
+	Comment    string
+}
+
+func (o *tableOptions) String() string {
+	strs := []string{fmt.Sprintf("AUTO_INCREMENT=%d", o.AutoIncrement)}
+	if len(o.AutoIDCache) > 0 {
+		strs = append(strs, "AUTO_ID_CACHE="+o.AutoIDCache)
+	}
+	if len(o.ShardRowIDBits) > 0 {
+		strs = append(strs, "SHARD_ROW_ID_BITS="+o.ShardRowIDBits)
+	}
+	strs = append(strs, o.AutoRandom...)
+	if len(o.Comment) > 0 {
+		strs = append(strs, fmt.Sprintf("COMMENT='%s'", o.Comment))
+	}
+	return strings.Join(strs, " ")
+}
+
+var (
+	autoIncrementValueRegexp = regexp.MustCompile(`\bAUTO_INCREMENT=(\d+)`)
+	autoIDCacheRegexp        = regexp.MustCompile(`\bAUTO_ID_CACHE=(\d+)`)
+	shardRowIDBitsRegexp     = regexp.MustCompile(`\bSHARD_ROW_ID_BITS=(\d+)`)
+	autoRandomRegexp         = regexp.MustCompile(`^\s*(` + "`[^`]+`" + `).*\b(AUTO_RANDOM\([^)]*\))`)
+	tableCommentRegexp       = regexp.MustCompile(`\bCOMMENT='((?:[^']|'')*)'`)
+)
+
+// parseTableOptions parses the options from the output of SHOW CREATE TABLE of MySQL or TiDB, like:
+//
+//	CREATE TABLE `t` (
+//	  `id` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */,
+//	  ...
+//	) ENGINE=InnoDB AUTO_INCREMENT=30001 /*T! SHARD_ROW_ID_BITS=4 */ /*T![auto_id_cache] AUTO_ID_CACHE=1 */ COMMENT='x'
+func parseTableOptions(createTable string) (*tableOptions, error) {
+	opts := new(tableOptions)
+
+	// the table options follow the last ")" of the column and index definitions,
+	// and the partition definitions come after the table options
+	tail := createTable
+	if idx := strings.LastIndex(createTable, "\n)"); idx >= 0 {
+		for _, line := range strings.Split(createTable[:idx], "\n") {
+			if m := autoRandomRegexp.FindStringSubmatch(line); m != nil {
+				opts.AutoRandom = append(opts.AutoRandom, m[1]+" "+m[2])
+			}
+		}
+		tail = createTable[idx+2:]
+	}
+	if idx := strings.Index(tail, "\n"); idx >= 0 {
+		tail = tail[:idx]
+	}
+
+	if m := autoIncrementValueRegexp.FindStringSubmatch(tail); m != nil {
+		id, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		opts.AutoIncrement = id
+	}
+	if m := autoIDCacheRegexp.FindStringSubmatch(tail); m != nil {
+		opts.AutoIDCache = m[1]
+	}
+	if m := shardRowIDBitsRegexp.FindStringSubmatch(tail); m != nil {
+		opts.ShardRowIDBits = m[1]
+	}
+	if m := tableCommentRegexp.FindStringSubmatch(tail); m != nil {
+		opts.Comment = m[1]
+	}
+	sort.Strings(opts.AutoRandom)
+	return opts, nil
+}
+
+// equalTableOptions tests whether the target can take over the table of the source, that is the next
+// auto increment id of target is not less than the source, so it won't allocate the ids already used,
+// and the other options are the same. It returns the formatted options of both side too.
+func (df *Diff) equalTableOptions(tblName string) (eq bool, opts1 string, opts2 string, err error) {
+	create1, err := getCreateTable(df.db1, tblName)
+	if err != nil {
+		return false, "", "", errors.Trace(err)
+	}
+	create2, err := getCreateTable(df.db2, tblName)
+	if err != nil {
+		return false, "", "", errors.Trace(err)
+	}
+
+	o1, err := parseTableOptions(create1)
+	if err != nil {
+		return false, "", "", errors.Annotatef(err, "parse options of table %s", tblName)
+	}
+	o2, err := parseTableOptions(create2)
+	if err != nil {
+		return false, "", "", errors.Annotatef(err, "parse options of table %s", tblName)
+	}
+
+	eq = o2.AutoIncrement >= o1.AutoIncrement &&
+		o1.AutoIDCache == o2.AutoIDCache &&
+		o1.ShardRowIDBits == o2.ShardRowIDBits &&
+		equalStrings(o1.AutoRandom, o2.AutoRandom) &&
+		o1.Comment == o2.Comment
+	return eq, o1.String(), o2.String(), nil
+}
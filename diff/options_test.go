@@ -0,0 +1,33 @@
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testOptionsSuite{})
+
+type testOptionsSuite struct{}
+
+func (s *testOptionsSuite) TestParseTableOptions(c *C) {
+	opts, err := parseTableOptions("CREATE TABLE `t` (\n" +
+		"  `id` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */,\n" +
+		"  `v` varchar(32) DEFAULT NULL COMMENT 'AUTO_INCREMENT=9',\n" +
+		"  PRIMARY KEY (`id`) /*T![clustered_index] CLUSTERED */\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin AUTO_INCREMENT=30001 " +
+		"/*T![auto_id_cache] AUTO_ID_CACHE=1 */ COMMENT='it''s t'\n" +
+		"PARTITION BY HASH (`id`) PARTITIONS 4")
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, &tableOptions{
+		AutoIncrement: 30001,
+		AutoIDCache:   "1",
+		AutoRandom:    []string{"`id` AUTO_RANDOM(5)"},
+		Comment:       "it''s t",
+	})
+
+	opts, err = parseTableOptions("CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT\n" +
+		") ENGINE=InnoDB /*T! SHARD_ROW_ID_BITS=4 */")
+	c.Assert(err, IsNil)
+	c.Assert(opts, DeepEquals, &tableOptions{ShardRowIDBits: "4"})
+	c.Assert(opts.String(), Equals, "AUTO_INCREMENT=0 SHARD_ROW_ID_BITS=4")
+}
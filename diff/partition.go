@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// partitionDef is the definition of one partition of a partitioned table.
+type partitionDef struct {
+	Name        string
+	Method      string
+	Expression  string
+	Description string
+}
+
+func (p partitionDef) String() string {
+	return fmt.Sprintf("%s %s(%s) values %s", p.Name, p.Method, p.Expression, p.Description)
+}
+
+func formatPartitionDefs(defs []partitionDef) string {
+	strs := make([]string, 0, len(defs))
+	for _, def := range defs {
+		strs = append(strs, def.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+// getPartitions returns the partitions of table in order, it returns nil if the table is not partitioned.
+func getPartitions(db *sql.DB, tblName string) ([]partitionDef, error) {
+	// there's one row for each subpartition, we only care about the partition
+	rows, err := db.Query("select PARTITION_NAME, PARTITION_METHOD, PARTITION_EXPRESSION, PARTITION_DESCRIPTION "+
+		"from information_schema.PARTITIONS where TABLE_SCHEMA = database() and TABLE_NAME = ? and PARTITION_NAME is not null "+
+		"and (SUBPARTITION_ORDINAL_POSITION is null or SUBPARTITION_ORDINAL_POSITION = 1) "+
+		"order by PARTITION_ORDINAL_POSITION", tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var defs []partitionDef
+	for rows.Next() {
+		var name, method, expr, desc sql.NullString
+		err := rows.Scan(&name, &method, &expr, &desc)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defs = append(defs, partitionDef{
+			Name:        name.String,
+			Method:      method.String,
+			Expression:  normalizeDefinition(expr.String),
+			Description: normalizeDefinition(desc.String),
+		})
+	}
+	return defs, errors.Trace(rows.Err())
+}
+
+func equalPartitionDefs(defs1, defs2 []partitionDef) bool {
+	if len(defs1) != len(defs2) {
+		return false
+	}
+	for i := range defs1 {
+		if defs1[i] != defs2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalPartitionDefs tests whether the table have the same partitions, it returns the formatted
+// definitions of both side too.
+func (df *Diff) equalPartitionDefs(tblName string) (eq bool, def1 string, def2 string, err error) {
+	ps1, ps2, _ := df.partitionedSources()
+	defs1, err := ps1.partitions(tblName)
+	if err != nil {
+		return false, "", "", errors.Trace(err)
+	}
+	defs2, err := ps2.partitions(tblName)
+	if err != nil {
+		return false, "", "", errors.Trace(err)
+	}
+
+	return equalPartitionDefs(defs1, defs2), formatPartitionDefs(defs1), formatPartitionDefs(defs2), nil
+}
+
+// commonPartitions returns the partition names if the table is partitioned the same way in both side.
+func (df *Diff) commonPartitions(tblName string) ([]string, error) {
+	ps1, ps2, _ := df.partitionedSources()
+	defs1, err := ps1.partitions(tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defs2, err := ps2.partitions(tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !equalPartitionDefs(defs1, defs2) {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(defs1))
+	for _, def := range defs1 {
+		names = append(names, def.Name)
+	}
+	return names, nil
+}
+
+// equalPartitionsData compares the data of the table partition by partition concurrently.
+// A partition failed is not retried alone, the caller retries the whole table.
+func (df *Diff) equalPartitionsData(tblName string, partitions []string) (bool, error) {
+	concurrency := df.cfg.PartitionConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	tokens := make(chan struct{}, concurrency)
+	results := make([]bool, len(partitions))
+	var eg errgroup.Group
+	for i, partition := range partitions {
+		i, partition := i, partition
+		tokens <- struct{}{}
+		eg.Go(func() error {
+			defer func() { <-tokens }()
+
+			eq, err := df.equalPartitionData(tblName, partition)
+			if err != nil {
+				return errors.Annotatef(err, "compare partition %s of table %s", partition, tblName)
+			}
+			if !eq {
+				log.Infof("table data different: %s partition: %s", tblName, partition)
+			}
+			results[i] = eq
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	for _, eq := range results {
+		if !eq {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package diff
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+// rangeSource emulates the tables partitioned by range of id, the test server ignores the partitions.
+type rangeSource struct {
+	*DBSource
+	defs []partitionDef
+
+	// fail is the partition failed to read
+	fail string
+
+	mu sync.Mutex
+	// read are the partitions read
+	read []string
+}
+
+func (s *rangeSource) partitions(tblName string) ([]partitionDef, error) {
+	return s.defs, nil
+}
+
+func (s *rangeSource) partitionRows(tblName string, partition string) (Rows, error) {
+	s.mu.Lock()
+	s.read = append(s.read, partition)
+	s.mu.Unlock()
+	if partition == s.fail {
+		return nil, driver.ErrBadConn
+	}
+
+	var conds []string
+	for i, def := range s.defs {
+		if def.Name != partition {
+			continue
+		}
+		if i > 0 {
+			conds = append(conds, "id >= "+s.defs[i-1].Description)
+		}
+		if def.Description != "MAXVALUE" {
+			conds = append(conds, "id < "+def.Description)
+		}
+	}
+	if len(conds) == 0 {
+		conds = append(conds, "true")
+	}
+	rows, err := querySQL(s.db, fmt.Sprintf("select * from `%s` where %s order by id", tblName, strings.Join(conds, " and ")))
+	if err != nil {
+		return nil, err
+	}
+	return newDBRows(rows, s.dialect)
+}
+
+func rangeDefs(bounds ...string) []partitionDef {
+	var defs []partitionDef
+	for i, bound := range bounds {
+		defs = append(defs, partitionDef{Name: fmt.Sprintf("p%d", i), Method: "RANGE", Expression: "`id`", Description: bound})
+	}
+	return defs
+}
+
+func (s *testHermeticSuite) TestPartitionDefinition(c *C) {
+	schema := []string{
+		"create table t(id bigint primary key, v bigint)",
+		"insert into t values(1, 1), (15, 15), (30, 30)",
+	}
+	db1 := s.ts.resetDB(c, "db1", schema...)
+	defer db1.Close()
+	db2 := s.ts.resetDB(c, "db2", schema...)
+	defer db2.Close()
+
+	src1 := &rangeSource{DBSource: NewDBSource(db1), defs: rangeDefs("10", "MAXVALUE")}
+	src2 := &rangeSource{DBSource: NewDBSource(db2), defs: rangeDefs("10", "MAXVALUE")}
+	eq, err := NewWithSource(nil, src1, src2).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	src2.defs = rangeDefs("20", "MAXVALUE")
+	df := NewWithSource(nil, src1, src2)
+	eq, err = df.EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+
+	report, err := df.Report()
+	c.Assert(err, IsNil)
+	c.Assert(report.Differences, HasLen, 1)
+	d := report.Differences[0]
+	c.Assert(d.Reason, Equals, "different partition definition")
+	c.Assert(d.Source, Equals, "p0 RANGE(`id`) values 10, p1 RANGE(`id`) values MAXVALUE")
+	c.Assert(d.Target, Equals, "p0 RANGE(`id`) values 20, p1 RANGE(`id`) values MAXVALUE")
+
+	// a partition more
+	src2.defs = rangeDefs("10", "20", "MAXVALUE")
+	eq, err = NewWithSource(nil, src1, src2).EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+}
+
+func (s *testHermeticSuite) TestPartitionData(c *C) {
+	schema := []string{
+		"create table t(id bigint primary key, v bigint)",
+		"insert into t values(1, 1), (11, 11), (15, 15), (21, 21)",
+	}
+	db1 := s.ts.resetDB(c, "db1", schema...)
+	defer db1.Close()
+	db2 := s.ts.resetDB(c, "db2", schema...)
+	defer db2.Close()
+	_, err := db2.Exec("update t set v = 0 where id = 15")
+	c.Assert(err, IsNil)
+
+	src1 := &rangeSource{DBSource: NewDBSource(db1), defs: rangeDefs("10", "20", "MAXVALUE")}
+	src2 := &rangeSource{DBSource: NewDBSource(db2), defs: rangeDefs("10", "20", "MAXVALUE")}
+	cfg := *defaultConfig
+	cfg.PartitionConcurrency = 1
+	df := NewWithSource(&cfg, src1, src2)
+
+	eq, err := df.EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+	// the data is compared partition by partition rather than the whole table
+	c.Assert(src1.read, DeepEquals, []string{"p0", "p1", "p2"})
+	c.Assert(src2.read, DeepEquals, []string{"p0", "p1", "p2"})
+
+	// only the partition having the row is different
+	for partition, expected := range map[string]bool{"p0": true, "p1": false, "p2": true} {
+		eq, err = df.equalPartitionData("t", partition)
+		c.Assert(err, IsNil)
+		c.Assert(eq, Equals, expected, Commentf("partition %s", partition))
+	}
+
+	_, err = db2.Exec("update t set v = 15 where id = 15")
+	c.Assert(err, IsNil)
+	eq, err = df.EqualTable("t")
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+}
+
+func (s *testHermeticSuite) TestPartitionRetry(c *C) {
+	schema := []string{
+		"create table t(id bigint primary key, v bigint)",
+		"insert into t values(1, 1), (11, 11), (21, 21)",
+	}
+	db1 := s.ts.resetDB(c, "db1", schema...)
+	defer db1.Close()
+	db2 := s.ts.resetDB(c, "db2", schema...)
+	defer db2.Close()
+
+	src1 := &rangeSource{DBSource: NewDBSource(db1), defs: rangeDefs("10", "20", "MAXVALUE"), fail: "p1"}
+	src2 := &rangeSource{DBSource: NewDBSource(db2), defs: rangeDefs("10", "20", "MAXVALUE")}
+	cfg := *defaultConfig
+	cfg.PartitionConcurrency = 1
+	cfg.MaxRetry = 2
+	cfg.RetryBackoff = time.Millisecond
+	df := NewWithSource(&cfg, src1, src2)
+
+	// the table is retried, but not the partition in the retry of the table
+	_, err := df.equalTableWithRetry("t")
+	c.Assert(errors.Cause(err), Equals, driver.ErrBadConn)
+	var failed int
+	for _, partition := range src1.read {
+		if partition == "p1" {
+			failed++
+		}
+	}
+	c.Assert(failed, Equals, cfg.MaxRetry+1)
+}
@@ -0,0 +1,138 @@
+package diff
+
+import (
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress is the progress of the running Equal or EqualTables of Diff.
+type Progress struct {
+	TablesDone  int
+	TablesTotal int
+	// Rows and Bytes are scanned from the source database
+	Rows  int64
+	Bytes int64
+
+	Elapsed time.Duration
+	// Remaining is the estimated time remaining by the tables done, 0 if no table done yet.
+	Remaining time.Duration
+}
+
+type progressTracker struct {
+	rows  int64
+	bytes int64
+
+	mu          sync.Mutex
+	start       time.Time
+	tablesDone  int
+	tablesTotal int
+	callback    func(Progress)
+	// tables are the rows and bytes scanned of each table in the current attempt
+	tables map[string]*tableProgress
+}
+
+// tableProgress counts the rows and bytes scanned of a table into the tracker.
+type tableProgress struct {
+	tracker *progressTracker
+	rows    int64
+	bytes   int64
+}
+
+// reset starts a new round of diff of total tables.
+func (t *progressTracker) reset(total int) {
+	atomic.StoreInt64(&t.rows, 0)
+	atomic.StoreInt64(&t.bytes, 0)
+
+	t.mu.Lock()
+	t.start = time.Now()
+	t.tablesDone = 0
+	t.tablesTotal = total
+	t.tables = nil
+	t.mu.Unlock()
+}
+
+// table returns the progress of the current attempt to compare the table.
+func (t *progressTracker) table(tblName string) *tableProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tables == nil {
+		t.tables = make(map[string]*tableProgress)
+	}
+	tp, ok := t.tables[tblName]
+	if !ok {
+		tp = &tableProgress{tracker: t}
+		t.tables[tblName] = tp
+	}
+	return tp
+}
+
+// resetTable starts a new attempt to compare the table, the rows scanned by the previous attempts are not
+// counted any more, so a retried table is not counted twice.
+func (t *progressTracker) resetTable(tblName string) {
+	t.mu.Lock()
+	tp, ok := t.tables[tblName]
+	delete(t.tables, tblName)
+	t.mu.Unlock()
+
+	if ok {
+		atomic.AddInt64(&t.rows, -atomic.LoadInt64(&tp.rows))
+		atomic.AddInt64(&t.bytes, -atomic.LoadInt64(&tp.bytes))
+	}
+}
+
+func (p *tableProgress) addRow(row []sql.RawBytes) {
+	var size int
+	for _, v := range row {
+		size += len(v)
+	}
+	atomic.AddInt64(&p.rows, 1)
+	atomic.AddInt64(&p.bytes, int64(size))
+	atomic.AddInt64(&p.tracker.rows, 1)
+	atomic.AddInt64(&p.tracker.bytes, int64(size))
+}
+
+func (t *progressTracker) tableDone() {
+	t.mu.Lock()
+	t.tablesDone++
+	callback := t.callback
+	t.mu.Unlock()
+
+	if callback != nil {
+		callback(t.progress())
+	}
+}
+
+func (t *progressTracker) progress() Progress {
+	t.mu.Lock()
+	p := Progress{
+		TablesDone:  t.tablesDone,
+		TablesTotal: t.tablesTotal,
+	}
+	if !t.start.IsZero() {
+		p.Elapsed = time.Since(t.start)
+	}
+	t.mu.Unlock()
+
+	p.Rows = atomic.LoadInt64(&t.rows)
+	p.Bytes = atomic.LoadInt64(&t.bytes)
+	if p.TablesDone > 0 && p.TablesTotal > p.TablesDone {
+		p.Remaining = p.Elapsed * time.Duration(p.TablesTotal-p.TablesDone) / time.Duration(p.TablesDone)
+	}
+	return p
+}
+
+// Progress returns the progress of the running Equal or EqualTables, or the last one if none is running.
+// It's safe to call it concurrently.
+func (df *Diff) Progress() Progress {
+	return df.progress.progress()
+}
+
+// SetProgressCallback sets the callback called each time a table is done.
+func (df *Diff) SetProgressCallback(callback func(Progress)) {
+	df.progress.mu.Lock()
+	df.progress.callback = callback
+	df.progress.mu.Unlock()
+}
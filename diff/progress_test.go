@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testProgressSuite{})
+
+type testProgressSuite struct{}
+
+// flakySource fails the first scan of a table after some rows.
+type flakySource struct {
+	*memSource
+	failTable string
+	failAfter int
+	failed    bool
+}
+
+func (s *flakySource) Rows(tblName string) (Rows, error) {
+	rows, err := s.memSource.Rows(tblName)
+	if err != nil || tblName != s.failTable || s.failed {
+		return rows, err
+	}
+	s.failed = true
+	return &flakyRows{Rows: rows, left: s.failAfter}, nil
+}
+
+type flakyRows struct {
+	Rows
+	left int
+}
+
+func (r *flakyRows) Next() bool {
+	if r.left == 0 {
+		return false
+	}
+	r.left--
+	return r.Rows.Next()
+}
+
+func (r *flakyRows) Err() error {
+	if r.left == 0 {
+		return driver.ErrBadConn
+	}
+	return r.Rows.Err()
+}
+
+func (s *testProgressSuite) TestProgress(c *C) {
+	var callbacks []Progress
+	df := NewWithSource(nil, newMemSource(), newMemSource())
+	df.SetProgressCallback(func(p Progress) {
+		callbacks = append(callbacks, p)
+	})
+
+	eq, err := df.Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	c.Assert(callbacks, HasLen, 2)
+	c.Assert(callbacks[0].TablesDone, Equals, 1)
+	c.Assert(callbacks[0].TablesTotal, Equals, 2)
+	c.Assert(callbacks[0].Rows, Equals, int64(4))
+
+	p := df.Progress()
+	c.Assert(p.TablesDone, Equals, 2)
+	c.Assert(p.Rows, Equals, int64(5))
+	// 1 a 2 3 4 \xff\x00 1 {"a": 1, "b": 2}
+	c.Assert(p.Bytes, Equals, int64(1+1+1+1+1+2+1+16))
+	c.Assert(p.Remaining, Equals, time.Duration(0))
+}
+
+func (s *testProgressSuite) TestProgressRetry(c *C) {
+	src := &flakySource{memSource: newMemSource(), failTable: "t1", failAfter: 3}
+	cfg := *defaultConfig
+	cfg.RetryBackoff = time.Millisecond
+	df := NewWithSource(&cfg, src, newMemSource())
+
+	eq, err := df.Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+	c.Assert(src.failed, IsTrue)
+
+	// the rows scanned by the failed attempt are not counted
+	p := df.Progress()
+	c.Assert(p.Rows, Equals, int64(5))
+	c.Assert(p.Bytes, Equals, int64(1+1+1+1+1+2+1+16))
+}
+
+func (s *testProgressSuite) TestResetTable(c *C) {
+	var t progressTracker
+	t.reset(2)
+	t.table("t1").addRow([]sql.RawBytes{sql.RawBytes("1"), sql.RawBytes("ab")})
+	t.table("t2").addRow([]sql.RawBytes{sql.RawBytes("1")})
+	c.Assert(t.progress().Rows, Equals, int64(2))
+	c.Assert(t.progress().Bytes, Equals, int64(4))
+
+	t.resetTable("t1")
+	c.Assert(t.progress().Rows, Equals, int64(1))
+	c.Assert(t.progress().Bytes, Equals, int64(1))
+	t.resetTable("t3")
+	c.Assert(t.progress().Rows, Equals, int64(1))
+}
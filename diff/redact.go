@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// RedactConfig is the columns whose values must not show up in the report or log of Diff.
+type RedactConfig struct {
+	// Tables redacts all the columns of these tables.
+	Tables []string `toml:"tables" json:"tables"`
+	// Columns maps a table name to the redacted columns of the table.
+	Columns map[string][]string `toml:"columns" json:"columns"`
+	// Hash shows the redacted value as a sha256 prefix instead of a mask, so the values can still be
+	// compared by eyes. Note the hash of a value of small domain like a phone number is easy to reverse.
+	Hash bool `toml:"hash" json:"hash"`
+}
+
+const redactedMask = "***"
+
+// IsRedacted returns true if the values of the column must be redacted, the names are case-insensitive.
+func (c *RedactConfig) IsRedacted(tblName, colName string) bool {
+	for _, tbl := range c.Tables {
+		if strings.EqualFold(tbl, tblName) {
+			return true
+		}
+	}
+	for tbl, cols := range c.Columns {
+		if !strings.EqualFold(tbl, tblName) {
+			continue
+		}
+		for _, col := range cols {
+			if strings.EqualFold(col, colName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Value formats the value of a column for output, NULL is shown as NULL even if redacted.
+func (c *RedactConfig) Value(tblName, colName string, v []byte) string {
+	if v == nil {
+		return "NULL"
+	}
+	if !c.IsRedacted(tblName, colName) {
+		return string(v)
+	}
+	if c.Hash {
+		sum := sha256.Sum256(v)
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return redactedMask
+}
+
+// formatRow formats the values of the columns idxs of the row like "`id`=1, `v`=***".
+func (c *RedactConfig) formatRow(tblName string, colNames []string, idxs []int, row []sql.RawBytes) string {
+	var buf bytes.Buffer
+	for i, idx := range idxs {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "`%s`=%s", colNames[idx], c.Value(tblName, colNames[idx], row[idx]))
+	}
+	return buf.String()
+}
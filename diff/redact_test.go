@@ -0,0 +1,33 @@
+package diff
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testRedactSuite{})
+
+type testRedactSuite struct{}
+
+func (s *testRedactSuite) TestValue(c *C) {
+	cfg := &RedactConfig{
+		Tables:  []string{"secret"},
+		Columns: map[string][]string{"users": {"Email"}},
+	}
+	c.Assert(cfg.IsRedacted("secret", "id"), IsTrue)
+	c.Assert(cfg.IsRedacted("USERS", "email"), IsTrue)
+	c.Assert(cfg.IsRedacted("users", "id"), IsFalse)
+	c.Assert(cfg.IsRedacted("t", "email"), IsFalse)
+
+	c.Assert(cfg.Value("users", "id", []byte("1")), Equals, "1")
+	c.Assert(cfg.Value("users", "email", []byte("a@b.c")), Equals, "***")
+	c.Assert(cfg.Value("users", "email", nil), Equals, "NULL")
+
+	cfg.Hash = true
+	hash := cfg.Value("users", "email", []byte("a@b.c"))
+	c.Assert(hash, Matches, "sha256:[0-9a-f]{16}")
+	c.Assert(cfg.Value("secret", "v", []byte("a@b.c")), Equals, hash)
+	c.Assert(cfg.Value("users", "email", []byte("a@b.d")), Not(Equals), hash)
+
+	var empty RedactConfig
+	c.Assert(empty.Value("users", "email", []byte{}), Equals, "")
+}
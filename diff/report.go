@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ObjectType is the type of a database object compared by Diff.
+type ObjectType string
+
+// The object types compared by Diff.
+const (
+	ObjectTable    ObjectType = "table"
+	ObjectView     ObjectType = "view"
+	ObjectTrigger  ObjectType = "trigger"
+	ObjectRoutine  ObjectType = "routine"
+	ObjectSequence ObjectType = "sequence"
+	ObjectUser     ObjectType = "user"
+)
+
+// Difference is one difference found between the source and target database.
+type Difference struct {
+	Object ObjectType
+	Name   string
+	Reason string
+	// Source and Target are the normalized definition of the object, empty if the object not exists
+	// or the difference is about data.
+	Source string
+	Target string
+	// Rows are the sample of different rows if the difference is about data, at most Config.MaxSampleRows.
+	Rows []RowSample
+}
+
+func (d *Difference) String() string {
+	s := fmt.Sprintf("%s %s: %s", d.Object, d.Name, d.Reason)
+	if len(d.Source) > 0 || len(d.Target) > 0 {
+		s += fmt.Sprintf(" [source] %s [target] %s", d.Source, d.Target)
+	}
+	for _, row := range d.Rows {
+		s += fmt.Sprintf("\n  row %s [source] %s [target] %s", row.Key, row.Source, row.Target)
+	}
+	return s
+}
+
+// Report is all the differences found between the source and target database.
+type Report struct {
+	Differences []*Difference
+}
+
+// Equal returns true if no difference found.
+func (r *Report) Equal() bool {
+	return len(r.Differences) == 0
+}
+
+func (r *Report) add(d *Difference) {
+	r.Differences = append(r.Differences, d)
+}
+
+func (r *Report) String() string {
+	if r.Equal() {
+		return "no difference"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d differences:", len(r.Differences))
+	for _, d := range r.Differences {
+		fmt.Fprintf(&buf, "\n%s", d)
+	}
+	return buf.String()
+}
@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"database/sql/driver"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+)
+
+// the error numbers of MySQL and TiDB may disappear by retrying
+const (
+	errNoSuchTable        = 1146
+	errTableDefChanged    = 1412
+	errInfoSchemaExpired  = 8027
+	errInfoSchemaChanged  = 8028
+	errPDServerTimeout    = 9001
+	errTiKVServerTimeout  = 9002
+	errTiKVServerBusy     = 9003
+	errResolveLockTimeout = 9004
+	errRegionUnavailable  = 9005
+	errTiKVStoreLimit     = 9008
+)
+
+const maxRetryBackoff = 30 * time.Second
+
+// IsRetryableError returns true if the error may disappear by retrying, like the table is dropped or
+// the schema is changed during the scan, or the connection is reset.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	cause := errors.Cause(err)
+	if myErr, ok := cause.(*mysql.MySQLError); ok {
+		switch myErr.Number {
+		case errNoSuchTable, errTableDefChanged, errInfoSchemaExpired, errInfoSchemaChanged,
+			errPDServerTimeout, errTiKVServerTimeout, errTiKVServerBusy, errResolveLockTimeout,
+			errRegionUnavailable, errTiKVStoreLimit:
+			return true
+		}
+		return strings.Contains(myErr.Message, "Information schema is changed")
+	}
+
+	switch cause {
+	case driver.ErrBadConn, mysql.ErrInvalidConn, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	if _, ok := cause.(net.Error); ok {
+		return true
+	}
+
+	msg := cause.Error()
+	return strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "Information schema is changed")
+}
+
+// withRetry calls fn until it returns nil or a fatal error, the retryable error is retried
+// at most cfg.MaxRetry times with exponential backoff.
+func (df *Diff) withRetry(desc string, fn func() (bool, error)) (bool, error) {
+	backoff := df.cfg.RetryBackoff
+	for i := 0; ; i++ {
+		eq, err := fn()
+		if err == nil || !IsRetryableError(err) || i >= df.cfg.MaxRetry {
+			return eq, errors.Trace(err)
+		}
+
+		log.Warnf("%s failed, retry after %s, retried %d times: %v", desc, backoff, i, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// equalTableWithRetry is like equalTableAndIndex but retries the table if get retryable error,
+// the table is taken as equal if it is dropped in both databases when we retry.
+func (df *Diff) equalTableWithRetry(tblName string) (bool, error) {
+	first := true
+	return df.withRetry("compare table "+tblName, func() (bool, error) {
+		if !first {
+			exist1, err := df.tableExist(df.src1, tblName)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			exist2, err := df.tableExist(df.src2, tblName)
+			if err != nil {
+				return false, errors.Trace(err)
+			}
+			if !exist1 && !exist2 {
+				log.Infof("table %s is dropped in both databases", tblName)
+				return true, nil
+			}
+			if exist1 != exist2 {
+				log.Infof("table %s only exists in one database", tblName)
+				return false, nil
+			}
+		}
+		first = false
+
+		df.progress.resetTable(tblName)
+		return df.equalTableAndIndex(tblName)
+	})
+}
+
+func (df *Diff) tableExist(src RowSource, tblName string) (bool, error) {
+	tbls, err := src.Tables()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	for _, tbl := range tbls {
+		if tbl == tblName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
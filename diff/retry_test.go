@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	pkgerrors "github.com/pingcap/errors"
+)
+
+var _ = Suite(&testRetrySuite{})
+
+type testRetrySuite struct{}
+
+func (s *testRetrySuite) TestIsRetryableError(c *C) {
+	c.Assert(IsRetryableError(nil), IsFalse)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: errNoSuchTable, Message: "Table 'test.t' doesn't exist"}), IsTrue)
+	c.Assert(IsRetryableError(pkgerrors.Trace(&mysql.MySQLError{Number: errInfoSchemaChanged})), IsTrue)
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1, Message: "Information schema is changed during the execution"}), IsTrue)
+	c.Assert(IsRetryableError(pkgerrors.Annotate(driver.ErrBadConn, "query")), IsTrue)
+	c.Assert(IsRetryableError(errors.New("read tcp: connection reset by peer")), IsTrue)
+
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}), IsFalse)
+	// the schema diverged, retrying doesn't help
+	c.Assert(IsRetryableError(&mysql.MySQLError{Number: 1054, Message: "Unknown column 'c' in 'field list'"}), IsFalse)
+	c.Assert(IsRetryableError(errors.New("some error")), IsFalse)
+}
+
+func (s *testRetrySuite) TestWithRetry(c *C) {
+	df := New(&Config{MaxRetry: 2, RetryBackoff: time.Millisecond}, nil, nil)
+
+	calls := 0
+	eq, err := df.withRetry("test", func() (bool, error) {
+		calls++
+		if calls < 3 {
+			return false, driver.ErrBadConn
+		}
+		return true, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+	c.Assert(calls, Equals, 3)
+
+	// give up after MaxRetry
+	calls = 0
+	_, err = df.withRetry("test", func() (bool, error) {
+		calls++
+		return false, driver.ErrBadConn
+	})
+	c.Assert(err, NotNil)
+	c.Assert(calls, Equals, 3)
+
+	// fatal error is not retried
+	calls = 0
+	_, err = df.withRetry("test", func() (bool, error) {
+		calls++
+		return false, errors.New("fatal")
+	})
+	c.Assert(err, NotNil)
+	c.Assert(calls, Equals, 1)
+}
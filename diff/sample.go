@@ -0,0 +1,171 @@
+package diff
+
+import (
+	"database/sql"
+
+	"github.com/pingcap/errors"
+)
+
+// RowSample is a row different between the source and target database.
+type RowSample struct {
+	// Key is the key of the row, like "`id`=1".
+	Key string
+	// Source and Target are all the values of the row, empty if the row not exists.
+	Source string
+	Target string
+}
+
+// sampleRows returns at most cfg.MaxSampleRows different rows of the table, the rows are matched by
+// the key of the source if it's a KeyedSource, or all the columns if not.
+// It returns nil if the tables have different columns.
+func (df *Diff) sampleRows(tblName string) ([]RowSample, error) {
+	if df.cfg.MaxSampleRows <= 0 {
+		return nil, nil
+	}
+
+	rows1, err := df.sampleSourceRows(df.src1, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows1.Close()
+
+	rows2, err := df.sampleSourceRows(df.src2, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows2.Close()
+
+	cols := rows1.Columns()
+	if !df.sameColumns(cols, rows2.Columns()) {
+		return nil, nil
+	}
+
+	colNames := make([]string, len(cols))
+	typeNames := make([]string, len(cols))
+	for i, col := range cols {
+		colNames[i] = col.Name
+		typeNames[i] = col.Type
+	}
+
+	keyIdxs := allIndexes(len(cols))
+	if keyed, ok := df.src1.(KeyedSource); ok {
+		keyNames, err := keyed.KeyColumns(tblName)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keyIdxs = columnIndexes(colNames, keyNames)
+	}
+
+	next := func(rows Rows) ([]sql.RawBytes, error) {
+		if !rows.Next() {
+			return nil, errors.Trace(rows.Err())
+		}
+		return copyRow(rows.Row()), nil
+	}
+	compareKey := func(r1, r2 []sql.RawBytes) int {
+		for _, idx := range keyIdxs {
+			if c := compareValue(typeNames[idx], r1[idx], r2[idx]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	format := func(r []sql.RawBytes, idxs []int) string {
+		return df.cfg.Redact.formatRow(tblName, colNames, idxs, r)
+	}
+	allIdxs := allIndexes(len(cols))
+
+	cur1, err := next(rows1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cur2, err := next(rows2)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var samples []RowSample
+	for (cur1 != nil || cur2 != nil) && len(samples) < df.cfg.MaxSampleRows {
+		var c int
+		switch {
+		case cur1 == nil:
+			c = 1
+		case cur2 == nil:
+			c = -1
+		default:
+			c = compareKey(cur1, cur2)
+		}
+
+		switch {
+		case c < 0:
+			samples = append(samples, RowSample{Key: format(cur1, keyIdxs), Source: format(cur1, allIdxs)})
+			cur1, err = next(rows1)
+		case c > 0:
+			samples = append(samples, RowSample{Key: format(cur2, keyIdxs), Target: format(cur2, allIdxs)})
+			cur2, err = next(rows2)
+		default:
+			row1 := rawBytesRow{typeNames: typeNames, rawBytes: cur1}
+			row2 := rawBytesRow{typeNames: typeNames, rawBytes: cur2}
+			if !row1.Equal(row2) {
+				samples = append(samples, RowSample{Key: format(cur1, keyIdxs), Source: format(cur1, allIdxs), Target: format(cur2, allIdxs)})
+			}
+			cur1, err = next(rows1)
+			if err == nil {
+				cur2, err = next(rows2)
+			}
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	return samples, nil
+}
+
+// sampleSourceRows returns the rows of the table read from src to be merged by compareValue, the rows of a MySQL
+// database are ordered by the binary keys instead of the collation of the keys.
+func (df *Diff) sampleSourceRows(src RowSource, tblName string) (Rows, error) {
+	s, ok := src.(*DBSource)
+	if !ok || s.Dialect() != MySQL {
+		return df.rows(src, tblName)
+	}
+	rows, err := s.binaryOrderedRows(tblName)
+	if err != nil || !df.crossDialect() {
+		return rows, errors.Trace(err)
+	}
+	return &canonicalRows{Rows: rows}, nil
+}
+
+func equalColumns(cols1, cols2 []Column) bool {
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for i := range cols1 {
+		if cols1[i] != cols2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// columnIndexes returns the index of names in colNames, it returns all the indexes if any name is not found.
+func columnIndexes(colNames []string, names []string) []int {
+	idxs := make([]int, 0, len(names))
+	for _, name := range names {
+		found := false
+		for i, colName := range colNames {
+			if colName == name {
+				idxs = append(idxs, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return allIndexes(len(colNames))
+		}
+	}
+	if len(idxs) == 0 {
+		return allIndexes(len(colNames))
+	}
+	return idxs
+}
@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"database/sql"
+	"fmt"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	. "github.com/pingcap/check"
+	"github.com/sirupsen/logrus"
+)
+
+// testServer is an in-process MySQL compatible server, so the tests don't need a real MySQL or TiDB.
+type testServer struct {
+	server *server.Server
+	addr   string
+	admin  *sql.DB
+}
+
+func newTestServer(c *C) *testServer {
+	logrus.SetLevel(logrus.ErrorLevel)
+
+	// index the primary key so it's returned by information_schema.STATISTICS like MySQL
+	provider := memory.NewDBProviderWithOpts(memory.NativeIndexProvider(true)).(*memory.DbProvider)
+	engine := sqle.NewDefault(provider)
+	cfg := server.Config{
+		Protocol: "tcp",
+		Address:  "127.0.0.1:0",
+	}
+	s, err := server.NewServer(cfg, engine, gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	c.Assert(err, IsNil)
+	go s.Start()
+
+	ts := &testServer{
+		server: s,
+		addr:   s.Listener.Addr().String(),
+	}
+	ts.admin = ts.open(c, "")
+	return ts
+}
+
+func (ts *testServer) dsn(dbName string) string {
+	return fmt.Sprintf("root@tcp(%s)/%s?interpolateParams=true&multiStatements=true", ts.addr, dbName)
+}
+
+func (ts *testServer) open(c *C, dbName string) *sql.DB {
+	db, err := sql.Open("mysql", ts.dsn(dbName))
+	c.Assert(err, IsNil)
+	return db
+}
+
+// resetDB drops and creates the database, then runs the stmts in it.
+func (ts *testServer) resetDB(c *C, dbName string, stmts ...string) *sql.DB {
+	_, err := ts.admin.Exec(fmt.Sprintf("drop database if exists `%s`", dbName))
+	c.Assert(err, IsNil)
+	_, err = ts.admin.Exec(fmt.Sprintf("create database `%s`", dbName))
+	c.Assert(err, IsNil)
+
+	db := ts.open(c, dbName)
+	for _, stmt := range stmts {
+		_, err = db.Exec(stmt)
+		c.Assert(err, IsNil, Commentf("db: %s stmt: %s", dbName, stmt))
+	}
+	return db
+}
+
+func (ts *testServer) close() {
+	ts.admin.Close()
+	ts.server.Close()
+}
@@ -0,0 +1,307 @@
+package diff
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// The snapshot is a stream of JSON objects, one object per line:
+//
+//	{"type":"header","version":1}
+//	{"type":"table","table":"t1","columns":[{"name":"id","type":"BIGINT"},{"name":"v","type":"VARCHAR"}],"key":["id"]}
+//	{"type":"row","values":["MQ==",null]}
+//	...
+//	{"type":"end","table":"t1","rows":1}
+//	{"type":"table","table":"t2",...}
+//	...
+//
+// The header comes first, then for each table a table record with the columns and the key if the source
+// knows it, the row records ordered by the key (or all columns if no key) and an end record with the count of rows.
+// The values of a row are the raw bytes of each column returned by the database encoded in base64,
+// NULL is encoded as null.
+const snapshotVersion = 1
+
+const (
+	snapshotHeader = "header"
+	snapshotTable  = "table"
+	snapshotRow    = "row"
+	snapshotEnd    = "end"
+)
+
+type snapshotRecord struct {
+	Type    string   `json:"type"`
+	Version int      `json:"version,omitempty"`
+	Table   string   `json:"table,omitempty"`
+	Columns []Column `json:"columns,omitempty"`
+	Key     []string `json:"key,omitempty"`
+	Values  [][]byte `json:"values,omitempty"`
+	Rows    int64    `json:"rows,omitempty"`
+}
+
+// WriteSnapshot writes the tables of src into w in the snapshot format, it writes all the tables if tables is empty.
+func WriteSnapshot(src RowSource, w io.Writer, tables ...string) error {
+	if len(tables) == 0 {
+		var err error
+		tables, err = src.Tables()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	err := enc.Encode(&snapshotRecord{Type: snapshotHeader, Version: snapshotVersion})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, tblName := range tables {
+		err = writeTableSnapshot(src, enc, tblName)
+		if err != nil {
+			return errors.Annotatef(err, "write snapshot of table %s", tblName)
+		}
+	}
+
+	return errors.Trace(bw.Flush())
+}
+
+func writeTableSnapshot(src RowSource, enc *json.Encoder, tblName string) error {
+	rows, err := src.Rows(tblName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	record := &snapshotRecord{Type: snapshotTable, Table: tblName, Columns: rows.Columns()}
+	if keyed, ok := src.(KeyedSource); ok {
+		record.Key, err = keyed.KeyColumns(tblName)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	err = enc.Encode(record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var count int64
+	record = &snapshotRecord{Type: snapshotRow}
+	for rows.Next() {
+		row := rows.Row()
+		record.Values = make([][]byte, len(row))
+		for i, v := range row {
+			if v != nil {
+				// keep the empty value different from NULL
+				record.Values[i] = append([]byte{}, v...)
+			}
+		}
+
+		err = enc.Encode(record)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(enc.Encode(&snapshotRecord{Type: snapshotEnd, Table: tblName, Rows: count}))
+}
+
+// SnapshotSource is a RowSource reading from a snapshot file written by WriteSnapshot.
+// The file is scanned once for the offset of each table, then a table is read from its offset.
+type SnapshotSource struct {
+	path string
+
+	indexOnce sync.Once
+	indexErr  error
+	// tables are the tables in the order of the snapshot, offsets are the offset of their table record
+	tables  []string
+	offsets map[string]int64
+}
+
+var _ KeyedSource = &SnapshotSource{}
+
+// NewSnapshotSource returns a SnapshotSource reading the snapshot file of path.
+func NewSnapshotSource(path string) *SnapshotSource {
+	return &SnapshotSource{path: path}
+}
+
+// index checks the header and finds out the offset of each table.
+func (s *SnapshotSource) index() error {
+	s.indexOnce.Do(func() {
+		s.indexErr = s.buildIndex()
+	})
+	return errors.Trace(s.indexErr)
+}
+
+func (s *SnapshotSource) buildIndex() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var header snapshotRecord
+	err = dec.Decode(&header)
+	if err != nil {
+		return errors.Annotatef(err, "read header of snapshot %s", s.path)
+	}
+	if header.Type != snapshotHeader || header.Version != snapshotVersion {
+		return errors.Errorf("unsupported snapshot %s, header: %+v", s.path, header)
+	}
+
+	s.offsets = make(map[string]int64)
+	for {
+		offset := dec.InputOffset()
+		var record snapshotRecord
+		err = dec.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if record.Type == snapshotTable {
+			s.tables = append(s.tables, record.Table)
+			s.offsets[record.Table] = offset
+		}
+	}
+}
+
+// Tables implements RowSource.
+func (s *SnapshotSource) Tables() ([]string, error) {
+	if err := s.index(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s.tables, nil
+}
+
+// Rows implements RowSource.
+func (s *SnapshotSource) Rows(tblName string) (Rows, error) {
+	rows, err := s.openTable(tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return rows, nil
+}
+
+// KeyColumns implements KeyedSource, it returns all the columns if the key is not in the snapshot.
+func (s *SnapshotSource) KeyColumns(tblName string) ([]string, error) {
+	rows, err := s.openTable(tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	if len(rows.key) > 0 {
+		return rows.key, nil
+	}
+	cols := make([]string, 0, len(rows.columns))
+	for _, col := range rows.columns {
+		cols = append(cols, col.Name)
+	}
+	return cols, nil
+}
+
+func (s *SnapshotSource) openTable(tblName string) (*snapshotRows, error) {
+	if err := s.index(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	offset, ok := s.offsets[tblName]
+	if !ok {
+		return nil, errors.NotFoundf("table %s in snapshot %s", tblName, s.path)
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, errors.Trace(err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var record snapshotRecord
+	err = dec.Decode(&record)
+	if err == nil && (record.Type != snapshotTable || record.Table != tblName) {
+		err = errors.Errorf("snapshot %s changed, expect table %s at offset %d", s.path, tblName, offset)
+	}
+	if err != nil {
+		f.Close()
+		return nil, errors.Trace(err)
+	}
+	return &snapshotRows{f: f, dec: dec, columns: record.Columns, key: record.Key}, nil
+}
+
+type snapshotRows struct {
+	f       *os.File
+	dec     *json.Decoder
+	columns []Column
+	key     []string
+	row     []sql.RawBytes
+	count   int64
+	done    bool
+	err     error
+}
+
+func (r *snapshotRows) Columns() []Column {
+	return r.columns
+}
+
+func (r *snapshotRows) Next() bool {
+	if r.done || r.err != nil {
+		return false
+	}
+
+	var record snapshotRecord
+	r.err = r.dec.Decode(&record)
+	if r.err == io.EOF {
+		r.err = errors.New("unexpected end of snapshot")
+	}
+	if r.err != nil {
+		return false
+	}
+
+	switch record.Type {
+	case snapshotRow:
+		r.row = make([]sql.RawBytes, len(record.Values))
+		for i, v := range record.Values {
+			r.row[i] = v
+		}
+		r.count++
+		return true
+	case snapshotEnd:
+		r.done = true
+		if record.Rows != r.count {
+			r.err = errors.Errorf("snapshot of table %s is broken, expect %d rows, but read %d rows", record.Table, record.Rows, r.count)
+		}
+		return false
+	default:
+		r.err = errors.Errorf("unexpected snapshot record type %s", record.Type)
+		return false
+	}
+}
+
+func (r *snapshotRows) Row() []sql.RawBytes {
+	return r.row
+}
+
+func (r *snapshotRows) Err() error {
+	return errors.Trace(r.err)
+}
+
+func (r *snapshotRows) Close() error {
+	return errors.Trace(r.f.Close())
+}
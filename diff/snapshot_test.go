@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testSnapshotSuite{})
+
+type testSnapshotSuite struct{}
+
+// memSource is a RowSource keeping the rows in memory.
+type memSource struct {
+	columns map[string][]Column
+	rows    map[string][][]sql.RawBytes
+	tables  []string
+}
+
+func (s *memSource) Tables() ([]string, error) {
+	return s.tables, nil
+}
+
+func (s *memSource) Rows(tblName string) (Rows, error) {
+	return &memRows{columns: s.columns[tblName], rows: s.rows[tblName], idx: -1}, nil
+}
+
+type memRows struct {
+	columns []Column
+	rows    [][]sql.RawBytes
+	idx     int
+}
+
+func (r *memRows) Columns() []Column   { return r.columns }
+func (r *memRows) Next() bool          { r.idx++; return r.idx < len(r.rows) }
+func (r *memRows) Row() []sql.RawBytes { return r.rows[r.idx] }
+func (r *memRows) Err() error          { return nil }
+func (r *memRows) Close() error        { return nil }
+
+func newMemSource() *memSource {
+	return &memSource{
+		tables: []string{"t1", "t2"},
+		columns: map[string][]Column{
+			"t1": {{Name: "id", Type: "BIGINT"}, {Name: "v", Type: "VARCHAR"}},
+			"t2": {{Name: "id", Type: "BIGINT"}, {Name: "doc", Type: "JSON"}},
+		},
+		rows: map[string][][]sql.RawBytes{
+			"t1": {
+				{sql.RawBytes("1"), sql.RawBytes("a")},
+				{sql.RawBytes("2"), nil},
+				{sql.RawBytes("3"), sql.RawBytes{}},
+				{sql.RawBytes("4"), sql.RawBytes{0xff, 0x00}},
+			},
+			"t2": {
+				{sql.RawBytes("1"), sql.RawBytes(`{"a": 1, "b": 2}`)},
+			},
+		},
+	}
+}
+
+func (s *testSnapshotSuite) writeSnapshot(c *C, src RowSource) string {
+	path := filepath.Join(c.MkDir(), "snapshot")
+	f, err := os.Create(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	c.Assert(WriteSnapshot(src, f), IsNil)
+	return path
+}
+
+func (s *testSnapshotSuite) TestRoundTrip(c *C) {
+	mem := newMemSource()
+	snap := NewSnapshotSource(s.writeSnapshot(c, mem))
+
+	tables, err := snap.Tables()
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, mem.tables)
+
+	rows, err := snap.Rows("t1")
+	c.Assert(err, IsNil)
+	defer rows.Close()
+	c.Assert(rows.Columns(), DeepEquals, mem.columns["t1"])
+
+	var got [][]sql.RawBytes
+	for rows.Next() {
+		got = append(got, rows.Row())
+	}
+	c.Assert(rows.Err(), IsNil)
+	c.Assert(got, HasLen, 4)
+	c.Assert(got[0], DeepEquals, mem.rows["t1"][0])
+	// NULL and empty value must be kept different
+	c.Assert(got[1][1], IsNil)
+	c.Assert(got[2][1], NotNil)
+	c.Assert(got[2][1], HasLen, 0)
+	c.Assert(got[3][1], DeepEquals, sql.RawBytes{0xff, 0x00})
+
+	// memSource doesn't know the key
+	key, err := snap.KeyColumns("t1")
+	c.Assert(err, IsNil)
+	c.Assert(key, DeepEquals, []string{"id", "v"})
+
+	_, err = snap.Rows("not_exist")
+	c.Assert(err, NotNil)
+}
+
+func (s *testSnapshotSuite) TestIndex(c *C) {
+	mem := newMemSource()
+	path := s.writeSnapshot(c, mem)
+	snap := NewSnapshotSource(path)
+
+	// the tables are read from their offset in any order
+	for _, tblName := range []string{"t2", "t1", "t2"} {
+		rows, err := snap.Rows(tblName)
+		c.Assert(err, IsNil)
+		c.Assert(rows.Columns(), DeepEquals, mem.columns[tblName])
+		var count int
+		for rows.Next() {
+			c.Assert(rows.Row(), DeepEquals, mem.rows[tblName][count])
+			count++
+		}
+		c.Assert(rows.Err(), IsNil)
+		c.Assert(count, Equals, len(mem.rows[tblName]))
+		c.Assert(rows.Close(), IsNil)
+	}
+	c.Assert(snap.offsets, HasLen, 2)
+	c.Assert(snap.offsets["t1"] < snap.offsets["t2"], IsTrue)
+
+	// the snapshot is indexed only once
+	c.Assert(os.Truncate(path, 0), IsNil)
+	tables, err := snap.Tables()
+	c.Assert(err, IsNil)
+	c.Assert(tables, DeepEquals, mem.tables)
+	_, err = snap.Rows("t1")
+	c.Assert(err, ErrorMatches, "EOF")
+
+	_, err = NewSnapshotSource(path).Tables()
+	c.Assert(err, ErrorMatches, "read header of snapshot .*: EOF")
+}
+
+func (s *testSnapshotSuite) TestDiffWithSnapshot(c *C) {
+	mem := newMemSource()
+	snap := NewSnapshotSource(s.writeSnapshot(c, mem))
+
+	eq, err := NewWithSource(nil, mem, snap).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	// change one value
+	changed := newMemSource()
+	changed.rows["t1"][2][1] = nil
+	eq, err = NewWithSource(nil, changed, snap).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+
+	// json is compared ignoring key order and whitespace
+	changed = newMemSource()
+	changed.rows["t2"][0][1] = sql.RawBytes(`{"b":2,"a":1}`)
+	eq, err = NewWithSource(nil, changed, snap).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+
+	// missing row
+	changed = newMemSource()
+	changed.rows["t1"] = changed.rows["t1"][:3]
+	eq, err = NewWithSource(nil, snap, changed).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsFalse)
+}
@@ -0,0 +1,246 @@
+package diff
+
+import (
+	"database/sql"
+
+	"github.com/ngaut/log"
+	"github.com/pingcap/errors"
+)
+
+// Column is a column of the rows read from a RowSource.
+type Column struct {
+	Name string `json:"name"`
+	// Type is the database type name like "BIGINT" or "JSON", see sql.ColumnType.DatabaseTypeName.
+	Type string `json:"type"`
+}
+
+// Rows iterates the rows of a table, the usage is the same as sql.Rows.
+type Rows interface {
+	Columns() []Column
+	Next() bool
+	// Row returns the current row, it's only valid until the next call of Next.
+	Row() []sql.RawBytes
+	Err() error
+	Close() error
+}
+
+// RowSource is where Diff reads the tables and rows from.
+type RowSource interface {
+	// Tables returns the name of the base tables in order.
+	Tables() ([]string, error)
+	// Rows returns the rows of the table ordered by the key identifying a row, or all columns if no such key.
+	Rows(tblName string) (Rows, error)
+}
+
+// KeyedSource is a RowSource knowing the key the rows are ordered by, it's used to match the rows of
+// two sources when showing the different rows.
+type KeyedSource interface {
+	RowSource
+	// KeyColumns returns the columns the rows of the table are ordered by.
+	KeyColumns(tblName string) ([]string, error)
+}
+
+// partitionedSource is a RowSource reading the partitions of a table one by one, like DBSource of MySQL.
+type partitionedSource interface {
+	RowSource
+	// partitions returns the partitions of the table in order, nil if the table is not partitioned.
+	partitions(tblName string) ([]partitionDef, error)
+	// partitionRows returns the rows of one partition of the table ordered like Rows.
+	partitionRows(tblName string, partition string) (Rows, error)
+}
+
+// DBSource is a RowSource reading from a database.
+type DBSource struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ KeyedSource = &DBSource{}
+var _ partitionedSource = &DBSource{}
+
+// NewDBSource returns a DBSource instance reading from a MySQL or TiDB database.
+func NewDBSource(db *sql.DB) *DBSource {
+	return NewDBSourceWithDialect(db, MySQL)
+}
+
+// NewDBSourceWithDialect returns a DBSource instance reading from a database of the dialect.
+func NewDBSourceWithDialect(db *sql.DB, dialect Dialect) *DBSource {
+	return &DBSource{db: db, dialect: dialect}
+}
+
+// DB returns the database of the source.
+func (s *DBSource) DB() *sql.DB {
+	return s.db
+}
+
+// Dialect returns the dialect of the database.
+func (s *DBSource) Dialect() Dialect {
+	return s.dialect
+}
+
+// Tables implements RowSource.
+func (s *DBSource) Tables() ([]string, error) {
+	tbls, err := s.dialect.Tables(s.db)
+	return tbls, errors.Trace(err)
+}
+
+// Rows implements RowSource.
+func (s *DBSource) Rows(tblName string) (Rows, error) {
+	query, err := selectOrderedSQL(s.dialect, s.db, tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// TODO select all data out may OOM if table is huge
+	rows, err := querySQL(s.db, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newDBRows(rows, s.dialect)
+}
+
+// KeyColumns implements KeyedSource.
+func (s *DBSource) KeyColumns(tblName string) ([]string, error) {
+	cols, err := s.dialect.OrderByColumns(s.db, tblName)
+	return cols, errors.Trace(err)
+}
+
+// binaryOrderedRows returns the rows of a MySQL table ordered by the binary keys like compareValue.
+func (s *DBSource) binaryOrderedRows(tblName string) (Rows, error) {
+	keyNames, err := s.KeyColumns(tblName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	query, err := selectBinaryOrderedSQL(s.db, tblName, keyNames)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rows, err := querySQL(s.db, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newDBRows(rows, s.dialect)
+}
+
+// partitions returns the partitions of a MySQL table.
+func (s *DBSource) partitions(tblName string) ([]partitionDef, error) {
+	defs, err := getPartitions(s.db, tblName)
+	return defs, errors.Trace(err)
+}
+
+// partitionRows returns the rows of one partition of a MySQL table.
+func (s *DBSource) partitionRows(tblName string, partition string) (Rows, error) {
+	rows, err := getPartitionRows(s.db, tblName, partition)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return newDBRows(rows, s.dialect)
+}
+
+type dbRows struct {
+	rows    *sql.Rows
+	row     rawBytesRow
+	dialect Dialect
+	// dbTypeNames is the type name returned by the database before normalized
+	dbTypeNames []string
+	columns     []Column
+	err         error
+}
+
+func newDBRows(rows *sql.Rows, dialect Dialect) (*dbRows, error) {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, errors.Trace(err)
+	}
+
+	r := &dbRows{
+		rows:    rows,
+		row:     newRawBytesRow(colTypes),
+		dialect: dialect,
+	}
+	for _, col := range colTypes {
+		typeName := col.DatabaseTypeName()
+		r.dbTypeNames = append(r.dbTypeNames, typeName)
+		r.columns = append(r.columns, Column{Name: col.Name(), Type: dialect.NormalizeType(typeName)})
+	}
+	return r, nil
+}
+
+func (r *dbRows) Columns() []Column {
+	return r.columns
+}
+
+func (r *dbRows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+	r.err = r.row.Scan(r.rows)
+	if r.err != nil {
+		return false
+	}
+
+	for i, v := range r.row.rawBytes {
+		r.row.rawBytes[i] = r.dialect.NormalizeValue(r.dbTypeNames[i], v)
+	}
+	return true
+}
+
+func (r *dbRows) Row() []sql.RawBytes {
+	return r.row.rawBytes
+}
+
+func (r *dbRows) Err() error {
+	if r.err != nil {
+		return errors.Trace(r.err)
+	}
+	return errors.Trace(r.rows.Err())
+}
+
+func (r *dbRows) Close() error {
+	return errors.Trace(r.rows.Close())
+}
+
+// equalSourceRows tests whether the two rows have same data, it consumes both rows.
+// The rows of rows1 are counted into progress.
+func equalSourceRows(rows1, rows2 Rows, progress *tableProgress) (bool, error) {
+	cols1 := rows1.Columns()
+	cols2 := rows2.Columns()
+	if len(cols1) != len(cols2) {
+		return false, nil
+	}
+
+	typeNames := make([]string, len(cols1))
+	for i, col := range cols1 {
+		typeNames[i] = col.Type
+	}
+
+	for rows1.Next() {
+		if !rows2.Next() {
+			if err := rows2.Err(); err != nil {
+				return false, errors.Trace(err)
+			}
+			// rows2 count less than rows1
+			log.Info("rows count different")
+			return false, nil
+		}
+
+		progress.addRow(rows1.Row())
+
+		row1 := rawBytesRow{typeNames: typeNames, rawBytes: rows1.Row()}
+		row2 := rawBytesRow{typeNames: typeNames, rawBytes: rows2.Row()}
+		if !row1.Equal(row2) {
+			return false, nil
+		}
+	}
+	if err := rows1.Err(); err != nil {
+		return false, errors.Trace(err)
+	}
+
+	if rows2.Next() {
+		// rows1 count less than rows2
+		log.Info("rows count different")
+		return false, nil
+	}
+	return true, errors.Trace(rows2.Err())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var minimizeMode string
+var minimizeRound int
+var minimizeOutput string
+var minimizeKeyColumn string
+var minimizeMaxTrials int
+var minimizeCheckTimeout time.Duration
+var minimizeTrialCheckTimeout time.Duration
+
+var minimizeCmd = &cobra.Command{
+	Use:   "minimize <journal>",
+	Short: "shrink a journal recorded by --journal to the statements still making the databases diverge",
+	Long: `
+Replay the journal recorded by --journal of a failed run again and again like bitest replay, with fewer workers,
+then fewer rows identified by --key-column, then fewer statements, and keep only the reductions after which
+the databases still diverge. The statements not run by a worker like creating the table and the DDL are always kept.
+
+Write the minimal statements as a SQL script to --output, and as a journal to <output>.journal to replay it again.
+Record the failed run with --seed and --journal, so it can be recorded again by the seed if the journal is lost.
+
+The first replay of the whole journal waits --check-timeout for the databases to converge, the trials after it wait
+--trial-check-timeout only at each check of the journal and at the end, as most of them diverge and wait the whole
+timeout.
+
+It only shrinks the recorded statements. To shrink the run itself, run the workload again with the same --seed and
+a smaller --n, --op-number or --p by hand, the seed doesn't reproduce the same statements of a different scale.
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := workload.ReadJournal(args[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		dsns, topoLayout, err := clusterDSNs(2)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		env := &workload.Env{
+			DSNs:    dsns,
+			Layout:  topoLayout,
+			Session: session,
+			Check:   workload.CheckOptions{Timeout: minimizeCheckTimeout, Interval: time.Second},
+		}
+		if len(layout) > 0 {
+			env.Layout = workload.Layout(layout)
+		}
+
+		opts := workload.MinimizeOptions{
+			Replay:    workload.ReplayOptions{Mode: workload.ReplayMode(minimizeMode), Round: minimizeRound},
+			KeyColumn: minimizeKeyColumn,
+			MaxTrials: minimizeMaxTrials,
+
+			TrialCheckTimeout: minimizeTrialCheckTimeout,
+		}
+		minimized, err := workload.Minimize(context.Background(), env, entries, opts)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		file, err := os.Create(minimizeOutput)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer file.Close()
+		err = workload.WriteSQL(file, minimized)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		err = workload.WriteJournal(minimizeOutput+".journal", minimized)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		log.Info("write minimized statements", zap.String("sql", minimizeOutput), zap.String("journal", minimizeOutput+".journal"))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(minimizeCmd)
+
+	addDBFlags(minimizeCmd.Flags(), 2)
+
+	minimizeCmd.Flags().BoolVar(&session, "session", true, "set the variable by session or not")
+	minimizeCmd.Flags().StringVar(&layout, "layout", "", "how the clusters replicate to each other: star, ring or mesh, override the layout of topology")
+	minimizeCmd.Flags().StringVar(&minimizeMode, "mode", string(workload.ReplaySerial), "worker to keep the order of each worker, or serial to run one by one in the order of start time")
+	minimizeCmd.Flags().IntVar(&minimizeRound, "round", 0, "minimize the statements of the round only, 0 means all the rounds")
+	minimizeCmd.Flags().StringVar(&minimizeOutput, "output", "minimized.sql", "path of the SQL script of the minimal statements")
+	minimizeCmd.Flags().StringVar(&minimizeKeyColumn, "key-column", workload.DefaultKeyColumn, "the column identifies the rows in the statements")
+	minimizeCmd.Flags().IntVar(&minimizeMaxTrials, "max-trials", workload.DefaultMaxTrials, "max number of replays")
+	minimizeCmd.Flags().DurationVar(&minimizeCheckTimeout, "check-timeout", time.Minute, "how long to wait for the databases to converge after the first replay of the whole journal, the databases diverge if not converge in it")
+	minimizeCmd.Flags().DurationVar(&minimizeTrialCheckTimeout, "trial-check-timeout", workload.DefaultTrialCheckTimeout, "how long to wait for the databases to converge at each check of a trial replay")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/july2993/bitest/diff"
+	"github.com/july2993/bitest/workload"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// divergence is an interval during which a table is not consistent between db1 and db2.
+type divergence struct {
+	Table string
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns how long the table stays divergent.
+func (d divergence) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// consistencyMonitor tracks the divergent intervals of every table across rounds of diff.
+type consistencyMonitor struct {
+	// table -> the time we first saw it divergent, for tables divergent now
+	open   map[string]time.Time
+	closed []divergence
+	// the intervals still open when we stop monitoring, they're not counted as time to consistency
+	unfinished []divergence
+}
+
+func newConsistencyMonitor() *consistencyMonitor {
+	return &consistencyMonitor{
+		open: make(map[string]time.Time),
+	}
+}
+
+// observe records the result of one round of diff taken at time now.
+// The marker table of the barriers is ignored, it's created and dropped by the workloads in each barrier.
+func (m *consistencyMonitor) observe(now time.Time, tables map[string]bool) {
+	delete(tables, workload.BarrierTable)
+	for tbl, eq := range tables {
+		start, divergent := m.open[tbl]
+		if !eq && !divergent {
+			m.open[tbl] = now
+			log.Info("table become divergent", zap.String("table", tbl))
+		} else if eq && divergent {
+			m.closeInterval(tbl, start, now)
+		}
+	}
+
+	// the table is dropped on both side, so it's consistent now
+	for tbl, start := range m.open {
+		if _, ok := tables[tbl]; !ok {
+			m.closeInterval(tbl, start, now)
+		}
+	}
+}
+
+func (m *consistencyMonitor) closeInterval(tbl string, start time.Time, end time.Time) {
+	delete(m.open, tbl)
+	d := divergence{Table: tbl, Start: start, End: end}
+	m.closed = append(m.closed, d)
+	log.Info("table become consistent", zap.String("table", tbl),
+		zap.Time("start", d.Start),
+		zap.Time("end", d.End),
+		zap.Duration("duration", d.Duration()))
+}
+
+// finish moves all the open intervals to unfinished with the end time now, they're still divergent when we stop
+// monitoring.
+func (m *consistencyMonitor) finish(now time.Time) (stillDivergent []string) {
+	for tbl := range m.open {
+		stillDivergent = append(stillDivergent, tbl)
+	}
+	sort.Strings(stillDivergent)
+	for _, tbl := range stillDivergent {
+		m.unfinished = append(m.unfinished, divergence{Table: tbl, Start: m.open[tbl], End: now})
+	}
+	m.open = make(map[string]time.Time)
+	return
+}
+
+var histogramBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+}
+
+// printSummary writes every divergent interval and a histogram of the durations to w, then the tables still
+// inconsistent, which are not in the histogram.
+func (m *consistencyMonitor) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "divergent intervals: %d\n", len(m.closed))
+	for _, d := range m.closed {
+		fmt.Fprintf(w, "  %-32s start: %s end: %s duration: %s\n", d.Table,
+			d.Start.Format(time.RFC3339), d.End.Format(time.RFC3339), d.Duration())
+	}
+
+	counts := make([]int, len(histogramBuckets)+1)
+	var maxDuration time.Duration
+	for _, d := range m.closed {
+		idx := sort.Search(len(histogramBuckets), func(i int) bool {
+			return d.Duration() < histogramBuckets[i]
+		})
+		counts[idx]++
+		if d.Duration() > maxDuration {
+			maxDuration = d.Duration()
+		}
+	}
+
+	fmt.Fprintf(w, "duration histogram (max: %s):\n", maxDuration)
+	for i, count := range counts {
+		var label string
+		if i < len(histogramBuckets) {
+			label = "< " + histogramBuckets[i].String()
+		} else {
+			label = ">= " + histogramBuckets[len(histogramBuckets)-1].String()
+		}
+		fmt.Fprintf(w, "  %-8s %6d %s\n", label, count, strings.Repeat("*", count))
+	}
+
+	fmt.Fprintf(w, "still inconsistent: %d\n", len(m.unfinished))
+	for _, d := range m.unfinished {
+		fmt.Fprintf(w, "  %-32s start: %s at least: %s\n", d.Table, d.Start.Format(time.RFC3339), d.Duration())
+	}
+}
+
+// monitorConsistency runs the diff against db1 and db2 every interval until duration passed (or forever if
+// duration is 0) or get interrupted, then print the summary of divergent intervals.
+// A round failed by a retryable error, like a table dropped by the workload, is logged and skipped, the monitor
+// stops at a fatal error and still prints the summary.
+func monitorConsistency(dsn1 string, dsn2 string, interval time.Duration, duration time.Duration) error {
+	db1, err := sql.Open("mysql", dsn1)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db1.Close()
+
+	db2, err := sql.Open("mysql", dsn2)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db2.Close()
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sc)
+
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+
+	m := newConsistencyMonitor()
+	df := diff.New(nil, db1, db2)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var monitorErr error
+	for {
+		tables, err := df.EqualTables()
+		if err != nil {
+			if !diff.IsRetryableError(err) {
+				monitorErr = errors.Trace(err)
+				break
+			}
+			log.Warn("diff failed, skip the round", zap.Error(err))
+		} else {
+			m.observe(time.Now(), tables)
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case s := <-sc:
+			log.Info("got signal to stop monitor", zap.Stringer("signal", s))
+		case <-deadline:
+		}
+		break
+	}
+
+	stillDivergent := m.finish(time.Now())
+	if len(stillDivergent) > 0 {
+		log.Warn("tables still divergent when stop monitor", zap.Strings("tables", stillDivergent))
+	}
+	m.printSummary(os.Stdout)
+
+	return monitorErr
+}
+
+var monitorInterval time.Duration
+var monitorDuration time.Duration
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "measure how long db1 and db2 stay inconsistent",
+	Long: `
+Keep running the diff between db1 and db2 every interval and record each interval during which a table is divergent,
+with its start time, end time and duration. Run it together with the dml workload to get the time to consistency.
+
+When stop by duration or signal, print all the divergent intervals and a histogram of the durations, and the tables
+still inconsistent, which are not in the histogram. The marker table of the barriers of the workloads is ignored.
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dsns, _, err := clusterDSNs(2)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		err = monitorConsistency(dsns[0], dsns[1], monitorInterval, monitorDuration)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+
+	addDBFlags(monitorCmd.Flags(), 2)
+
+	monitorCmd.Flags().DurationVar(&monitorInterval, "interval", time.Second, "interval between two rounds of diff")
+	monitorCmd.Flags().DurationVar(&monitorDuration, "duration", 0, "how long to monitor, 0 means until interrupted")
+}
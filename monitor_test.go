@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testMonitorSuite{})
+
+type testMonitorSuite struct{}
+
+func (s *testMonitorSuite) TestObserve(c *C) {
+	m := newConsistencyMonitor()
+	start := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	m.observe(at(0), map[string]bool{"a": true, "b": false, "c": false})
+	c.Assert(m.open, DeepEquals, map[string]time.Time{"b": at(0), "c": at(0)})
+	c.Assert(m.closed, HasLen, 0)
+
+	// still divergent, the start is not changed
+	m.observe(at(1), map[string]bool{"a": false, "b": false, "c": false})
+	c.Assert(m.open, DeepEquals, map[string]time.Time{"a": at(1), "b": at(0), "c": at(0)})
+
+	// b becomes consistent, c is dropped on both sides
+	m.observe(at(3), map[string]bool{"a": false, "b": true})
+	c.Assert(m.open, DeepEquals, map[string]time.Time{"a": at(1)})
+	c.Assert(m.closed, HasLen, 2)
+	byTable := make(map[string]divergence)
+	for _, d := range m.closed {
+		byTable[d.Table] = d
+	}
+	c.Assert(byTable["b"], Equals, divergence{Table: "b", Start: at(0), End: at(3)})
+	c.Assert(byTable["c"], Equals, divergence{Table: "c", Start: at(0), End: at(3)})
+	c.Assert(byTable["b"].Duration(), Equals, 3*time.Second)
+
+	// the marker table of the barriers comes and goes with the barriers
+	m.observe(at(4), map[string]bool{"a": false, workload.BarrierTable: false})
+	c.Assert(m.open, DeepEquals, map[string]time.Time{"a": at(1)})
+}
+
+func (s *testMonitorSuite) TestFinish(c *C) {
+	m := newConsistencyMonitor()
+	start := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	m.observe(start, map[string]bool{"b": false, "a": false, "c": true})
+
+	stillDivergent := m.finish(start.Add(time.Minute))
+	c.Assert(stillDivergent, DeepEquals, []string{"a", "b"})
+	c.Assert(m.open, HasLen, 0)
+	// the intervals not finished are not taken as time to consistency
+	c.Assert(m.closed, HasLen, 0)
+	c.Assert(m.unfinished, DeepEquals, []divergence{
+		{Table: "a", Start: start, End: start.Add(time.Minute)},
+		{Table: "b", Start: start, End: start.Add(time.Minute)},
+	})
+
+	c.Assert(m.finish(start.Add(2*time.Minute)), HasLen, 0)
+	c.Assert(m.unfinished, HasLen, 2)
+}
+
+func (s *testMonitorSuite) TestPrintSummary(c *C) {
+	m := newConsistencyMonitor()
+	start := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i, d := range []time.Duration{500 * time.Millisecond, 2 * time.Second, 3 * time.Second, time.Hour} {
+		m.closed = append(m.closed, divergence{Table: string(rune('a' + i)), Start: start, End: start.Add(d)})
+	}
+
+	m.observe(start, map[string]bool{"e": false})
+	m.finish(start.Add(2 * time.Hour))
+
+	var buf bytes.Buffer
+	m.printSummary(&buf)
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	c.Assert(lines[0], Equals, "divergent intervals: 4")
+	c.Assert(strings.Fields(lines[1]), DeepEquals, []string{"a", "start:", "2020-01-02T15:04:05Z", "end:", "2020-01-02T15:04:05Z", "duration:", "500ms"})
+	c.Assert(lines[5], Equals, "duration histogram (max: 1h0m0s):")
+
+	histogram := lines[6 : 6+len(histogramBuckets)+1]
+	c.Assert(strings.Fields(histogram[0]), DeepEquals, []string{"<", "1s", "1", "*"})
+	c.Assert(strings.Fields(histogram[1]), DeepEquals, []string{"<", "5s", "2", "**"})
+	c.Assert(strings.Fields(histogram[2]), DeepEquals, []string{"<", "10s", "0"})
+	c.Assert(strings.Fields(histogram[len(histogramBuckets)]), DeepEquals, []string{">=", "10m0s", "1", "*"})
+
+	// the table still inconsistent is not in the histogram
+	unfinished := lines[6+len(histogramBuckets)+1:]
+	c.Assert(unfinished, HasLen, 2)
+	c.Assert(unfinished[0], Equals, "still inconsistent: 1")
+	c.Assert(strings.Fields(unfinished[1]), DeepEquals, []string{"e", "start:", "2020-01-02T15:04:05Z", "at", "least:", "2h0m0s"})
+
+	buf.Reset()
+	newConsistencyMonitor().printSummary(&buf)
+	c.Assert(strings.HasPrefix(buf.String(), "divergent intervals: 0\nduration histogram (max: 0s):\n"), IsTrue)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+
+	"github.com/july2993/bitest/workload"
+	"github.com/pingcap/errors"
+	"github.com/spf13/cobra"
+)
+
+var replayMode string
+var replayRound int
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <journal>",
+	Short: "replay the statements recorded by --journal of a workload",
+	Long: `
+Run the statements of a journal recorded by --journal of a workload against the databases, then check all the
+databases converge. The databases should be fresh and replicate to each other like the ones of the recorded run,
+with the same number of databases so auto_increment_increment and auto_increment_offset are the same.
+
+With --mode worker, the workers run concurrently and each worker runs its statements in the recorded order,
+a statement starts after all the statements ended before it started in the journal.
+With --mode serial, all the statements run one by one in the order they started.
+The workload waited for the databases to converge at some points, like after creating the table, replay waits too.
+	`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := workload.ReadJournal(args[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		dsns, topoLayout, err := clusterDSNs(2)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		env := &workload.Env{
+			DSNs:    dsns,
+			Layout:  topoLayout,
+			Session: session,
+		}
+		if len(layout) > 0 {
+			env.Layout = workload.Layout(layout)
+		}
+
+		opts := workload.ReplayOptions{Mode: workload.ReplayMode(replayMode), Round: replayRound}
+		return errors.Trace(workload.Replay(context.Background(), env, entries, opts))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	addDBFlags(replayCmd.Flags(), 2)
+
+	replayCmd.Flags().BoolVar(&session, "session", true, "set the variable by session or not")
+	replayCmd.Flags().StringVar(&layout, "layout", "", "how the clusters replicate to each other: star, ring or mesh, override the layout of topology")
+	replayCmd.Flags().StringVar(&replayMode, "mode", string(workload.ReplayWorker), "worker to keep the order of each worker, or serial to run one by one in the order of start time")
+	replayCmd.Flags().IntVar(&replayRound, "round", 0, "replay the statements of the round only, 0 means all the rounds")
+}
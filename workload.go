@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+var loop bool
+var timeout time.Duration
+
+var topologyPath string
+var clusterNames []string
+var layout string
+var seed int64
+var journalPath string
+var barrier bool
+
+var heartbeatInterval time.Duration
+var lagSLO time.Duration
+var heartbeatSources []int
+
+// registerWorkload adds the sub command of w to bitest.
+func registerWorkload(w workload.Workload) {
+	rootCmd.AddCommand(newWorkloadCmd(w))
+}
+
+func newWorkloadCmd(w workload.Workload) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   w.Name(),
+		Short: w.Short(),
+		Long:  w.Long(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dsns, topoLayout, err := clusterDSNs(w.Clusters())
+			if err != nil {
+				return err
+			}
+			env := &workload.Env{
+				DSNs:      dsns,
+				Layout:    topoLayout,
+				P:         p,
+				Session:   session,
+				Seed:      seed,
+				NoBarrier: !barrier,
+			}
+			if len(layout) > 0 {
+				env.Layout = workload.Layout(layout)
+			}
+			env.Heartbeat = workload.HeartbeatOptions{Interval: heartbeatInterval, SLO: lagSLO}
+			for _, src := range heartbeatSources {
+				env.Heartbeat.Sources = append(env.Heartbeat.Sources, src-1)
+			}
+			if len(journalPath) > 0 {
+				env.Journal, err = workload.OpenJournal(journalPath)
+				if err != nil {
+					return err
+				}
+				defer env.Journal.Close()
+			}
+
+			err = workload.Run(context.Background(), w, env, workload.RunOptions{Loop: loop, Timeout: timeout})
+			if err != nil {
+				log.Info("fail test", zap.String("workload", w.Name()), zap.Error(err))
+				return err
+			}
+			return nil
+		},
+	}
+
+	addDBFlags(cmd.Flags(), w.Clusters())
+	cmd.Flags().IntVar(&p, "p", 16, "max open connection to db concurrently")
+	cmd.Flags().BoolVar(&session, "session", true, "set the variable by session or not")
+	cmd.Flags().BoolVar(&loop, "loop", false, "run test in loop only quit if meet error")
+	cmd.Flags().StringVar(&layout, "layout", "", "how the clusters replicate to each other: star, ring or mesh, override the layout of topology")
+	cmd.Flags().Int64Var(&seed, "seed", 0, "seed of the random statements, it's logged at start and the failed round, 0 means a random one")
+	cmd.Flags().BoolVar(&barrier, "barrier", true, "wait for a marker row in the workload database replicated before checking the data, disable it if the replication applies the tables in parallel")
+	cmd.Flags().StringVar(&journalPath, "journal", "", "path of the file to record the statements of the workload, empty means not record")
+	cmd.Flags().DurationVar(&heartbeatInterval, "heartbeat-interval", 0, "interval of the heartbeats to measure the replication lag, 0 means no heartbeat")
+	cmd.Flags().DurationVar(&lagSLO, "lag-slo", 0, "fail the test if the replication lag of the heartbeats exceeds it, 0 means no slo, it needs --heartbeat-interval")
+	cmd.Flags().IntSliceVar(&heartbeatSources, "heartbeat-sources", nil, "number of the dbs writing the heartbeats, like 1,2, all the dbs by default, it needs --heartbeat-interval")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "timeout of each round of the test, 0 means no timeout")
+	if fb, ok := w.(workload.FlagBinder); ok {
+		fb.Flags(cmd.Flags())
+	}
+	return cmd
+}
+
+// addDBFlags adds the flags to connect db1, and db2 if clusters is 2.
+func addDBFlags(fs *pflag.FlagSet, clusters int) {
+	fs.StringVar(&topologyPath, "topology", "", "path of the topology file of the clusters, the flags of db are ignored if it's set")
+	fs.StringSliceVar(&clusterNames, "clusters", nil, "names of the clusters in the topology to use, all the clusters with the primary ones first by default")
+
+	fs.StringVar(&user, "user", "root", "user of db")
+	fs.StringVar(&password, "psw", "", "password of db")
+	fs.StringVar(&host, "host", "127.0.0.1", "host of db")
+	fs.IntVar(&port, "port", 4000, "port of db")
+	if clusters < 2 {
+		return
+	}
+
+	fs.StringVar(&user2, "user2", "root", "user of db")
+	fs.StringVar(&password2, "psw2", "", "password of db")
+	fs.StringVar(&host2, "host2", "127.0.0.1", "host of db")
+	fs.IntVar(&port2, "port2", 5000, "port of db")
+}
+
+func buildDSN(user string, password string, host string, port int) string {
+	return workload.DBConfig{User: user, Password: password, Host: host, Port: port}.DSN()
+}
+
+// clusterDSNs returns the dsn of at least n clusters and the layout of them, from the topology file if set
+// or else the flags of db.
+func clusterDSNs(n int) ([]string, workload.Layout, error) {
+	if len(topologyPath) == 0 {
+		dsns := []string{buildDSN(user, password, host, port), buildDSN(user2, password2, host2, port2)}
+		return dsns[:n], "", nil
+	}
+
+	topo, err := workload.LoadTopology(topologyPath)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	clusters, err := topo.Select(clusterNames, n)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+
+	dsns := make([]string, 0, n)
+	for _, c := range clusters {
+		log.Info("use cluster", zap.String("name", c.Name), zap.String("role", c.Role))
+		dsns = append(dsns, c.DSN())
+	}
+	return dsns, topo.Layout, nil
+}
+
+func init() {
+	registerWorkload(workload.NewOffset(workload.OffsetOptions{}))
+	registerWorkload(workload.NewDML(workload.DMLOptions{}))
+	registerWorkload(workload.NewDDL())
+	registerWorkload(workload.NewConflict(workload.ConflictOptions{}))
+	registerWorkload(workload.NewTxn(workload.TxnOptions{}))
+}
@@ -0,0 +1,125 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/july2993/bitest/diff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// barrierPollInterval is the interval between two reads of a marker in a database.
+const barrierPollInterval = 50 * time.Millisecond
+
+// BarrierTable is the marker table of Barrier in the workload database, it only exists while a barrier runs.
+const BarrierTable = "bitest_barrier"
+
+// Barrier waits until the writes done in each database before it are replicated to all the others. It writes a
+// unique marker row to each database in turn, starting from the first one, and waits until the marker is visible in
+// all the other databases, so the replication in order has replicated everything before the marker.
+// The marker table is in the workload database to be replicated by the same filters as the workload tables, it's
+// dropped in the first database after the markers, and the barrier passes once the drop is replicated too, so the
+// data checks don't see it. The replication applying the tables in parallel may replicate the marker table ahead of
+// the others, the barrier proves nothing then.
+// It fails if a marker or the drop is not replicated in the timeout.
+func Barrier(ctx context.Context, dbs []*sql.DB, timeout time.Duration) error {
+	if len(dbs) < 2 {
+		return nil
+	}
+	// the table is left by a failed barrier
+	_, err := dbs[0].ExecContext(ctx, fmt.Sprintf("create table if not exists %s(id varchar(64) primary key, src int, ts bigint)", BarrierTable))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	token := fmt.Sprintf("%d-%d", start.UnixNano(), rand.Int63())
+	// the table is created in the first database, so the others write their markers after it's replicated
+	for src, db := range dbs {
+		id := fmt.Sprintf("%s-%d", token, src)
+		_, err = db.ExecContext(ctx, fmt.Sprintf("insert into %s(id, src, ts) values(?, ?, ?)", BarrierTable), id, src, time.Now().UnixNano())
+		if err != nil {
+			return errors.Annotatef(err, "write marker to db%d", src+1)
+		}
+
+		for dst := range dbs {
+			if dst == src {
+				continue
+			}
+			err = waitMarker(ctx, dbs[dst], id)
+			if err != nil {
+				return errors.Annotatef(err, "marker of db%d not replicated to db%d in %s", src+1, dst+1, timeout)
+			}
+		}
+	}
+
+	// prune the markers
+	_, err = dbs[0].ExecContext(ctx, fmt.Sprintf("drop table %s", BarrierTable))
+	if err != nil {
+		return errors.Annotate(err, "drop the markers")
+	}
+	for dst := 1; dst < len(dbs); dst++ {
+		err = waitDropped(ctx, dbs[dst])
+		if err != nil {
+			return errors.Annotatef(err, "drop of the markers not replicated to db%d in %s", dst+1, timeout)
+		}
+	}
+	log.Info("pass barrier", zap.Int("dbs", len(dbs)), zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+// waitMarker waits until the marker of id is visible in db.
+func waitMarker(ctx context.Context, db *sql.DB, id string) error {
+	return waitBarrier(ctx, func() (bool, error) {
+		var count int
+		err := db.QueryRowContext(ctx, fmt.Sprintf("select count(*) from %s where id = ?", BarrierTable), id).Scan(&count)
+		return count > 0, err
+	})
+}
+
+// waitDropped waits until the marker table is dropped in db.
+func waitDropped(ctx context.Context, db *sql.DB) error {
+	return waitBarrier(ctx, func() (bool, error) {
+		var count int
+		err := db.QueryRowContext(ctx, "select count(*) from information_schema.tables where table_schema = database() and table_name = ?", BarrierTable).Scan(&count)
+		return count == 0, err
+	})
+}
+
+// waitBarrier polls done until it returns true.
+func waitBarrier(ctx context.Context, done func() (bool, error)) error {
+	ticker := time.NewTicker(barrierPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := done()
+		if err == nil && ok {
+			return nil
+		}
+		// the marker table is not replicated yet without the table
+		if err != nil && ctx.Err() == nil && !diff.IsRetryableError(err) {
+			return errors.Trace(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// barrier runs Barrier on dbs unless NoBarrier, in the timeout of the data checks.
+func (env *Env) barrier(ctx context.Context, dbs []*sql.DB) error {
+	if env.NoBarrier {
+		return nil
+	}
+	return errors.Trace(Barrier(ctx, dbs, env.Check.withDefault().Timeout))
+}
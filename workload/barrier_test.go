@@ -0,0 +1,65 @@
+package workload_test
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testBarrierSuite{})
+
+type testBarrierSuite struct{}
+
+func (s *testBarrierSuite) TestBarrier(c *C) {
+	srv1, admin1, dsns1 := startServer(c)
+	defer srv1.Close()
+	defer admin1.Close()
+	srv2, admin2, dsns2 := startServer(c)
+	defer srv2.Close()
+	defer admin2.Close()
+
+	open := func(dsns ...string) []*sql.DB {
+		var dbs []*sql.DB
+		for _, dsn := range dsns {
+			db, err := sql.Open("mysql", dsn)
+			c.Assert(err, IsNil)
+			dbs = append(dbs, db)
+		}
+		return dbs
+	}
+
+	// both of the clusters are db1, so the markers are replicated at once
+	dbs := open(dsns1[0], dsns1[0])
+	c.Assert(workload.Barrier(context.Background(), dbs, time.Second), IsNil)
+	c.Assert(workload.Barrier(context.Background(), dbs, time.Second), IsNil)
+	// the markers are dropped after the barrier
+	var count int
+	c.Assert(admin1.QueryRow("select count(*) from information_schema.tables where table_name = 'bitest_barrier'").Scan(&count), IsNil)
+	c.Assert(count, Equals, 0)
+
+	// the marker of db1 never reaches db2 on another server
+	dbs = open(dsns1[0], dsns2[0])
+	err := workload.Barrier(context.Background(), dbs, 100*time.Millisecond)
+	c.Assert(err, ErrorMatches, "marker of db1 not replicated to db2 in 100ms: context deadline exceeded")
+}
+
+func (s *testBarrierSuite) TestDML(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	// the data is checked after the barriers without waiting
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0]},
+		P:       2,
+		Session: true,
+		Seed:    1,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	start := time.Now()
+	c.Assert(workload.RunRound(context.Background(), workload.NewDML(workload.DMLOptions{N: 10, OpNumber: 100}), env, time.Minute), IsNil)
+	c.Assert(time.Since(start) < 5*time.Second, IsTrue)
+}
@@ -0,0 +1,197 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/july2993/bitest/diff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// CheckOptions is how CheckData checks the data of two databases.
+type CheckOptions struct {
+	// Diff is the config of diff, nil means the default one.
+	Diff *diff.Config
+	// Timeout is how long to wait for the data become equal, 0 means DefaultCheckTimeout.
+	Timeout time.Duration
+	// Interval is the interval between two rounds of diff, 0 means DefaultCheckInterval.
+	Interval time.Duration
+	// ProgressInterval is how often to log the progress of a round of diff, 0 means DefaultProgressInterval.
+	ProgressInterval time.Duration
+}
+
+// The defaults of CheckOptions.
+const (
+	DefaultCheckTimeout     = time.Hour
+	DefaultCheckInterval    = 10 * time.Second
+	DefaultProgressInterval = 30 * time.Second
+)
+
+func (o CheckOptions) withDefault() CheckOptions {
+	if o.Timeout == 0 {
+		o.Timeout = DefaultCheckTimeout
+	}
+	if o.Interval == 0 {
+		o.Interval = DefaultCheckInterval
+	}
+	if o.ProgressInterval == 0 {
+		o.ProgressInterval = DefaultProgressInterval
+	}
+	return o
+}
+
+// logDiffProgress logs the progress of df every interval until stop is closed.
+func logDiffProgress(df *diff.Diff, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p := df.Progress()
+		log.Info("check data progress",
+			zap.Int("tables-done", p.TablesDone),
+			zap.Int("tables-total", p.TablesTotal),
+			zap.Int64("rows", p.Rows),
+			zap.Int64("bytes", p.Bytes),
+			zap.Duration("elapsed", p.Elapsed),
+			zap.Duration("remaining", p.Remaining))
+	}
+}
+
+// ErrNotEqual is the cause of the error of CheckData and CheckConverge if the data is not equal in the timeout.
+var ErrNotEqual = errors.New("failed to check equal")
+
+// CheckData waits until db1 and db2 have the same data, or fails after the timeout or ctx is done.
+func CheckData(ctx context.Context, db1 *sql.DB, db2 *sql.DB, opts CheckOptions) error {
+	opts = opts.withDefault()
+	start := time.Now()
+	df := diff.New(opts.Diff, db1, db2)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go logDiffProgress(df, opts.ProgressInterval, stop)
+
+	for {
+		// the diff doesn't watch ctx, check it before each round
+		if ctx.Err() != nil {
+			return errors.Annotate(ctx.Err(), "failed to check equal")
+		}
+
+		equal, err := df.Equal()
+		if err != nil {
+			if !diff.IsRetryableError(err) {
+				return errors.Trace(err)
+			}
+			log.Warn("check data failed, will check again", zap.Error(err))
+		}
+
+		if equal && err == nil {
+			return nil
+		}
+
+		if time.Since(start) > opts.Timeout {
+			return errors.Trace(ErrNotEqual)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Annotate(ctx.Err(), "failed to check equal")
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// CheckConverge waits until all the databases have the same data. The equality is transitive,
+// so it checks every database against the first one, which means every pair converges.
+// If not converged in the timeout, the diverged replication links of layout are logged.
+func CheckConverge(ctx context.Context, dbs []*sql.DB, layout Layout, opts CheckOptions) error {
+	opts = opts.withDefault()
+	start := time.Now()
+	for i := 1; i < len(dbs); i++ {
+		o := opts
+		o.Timeout = opts.Timeout - time.Since(start)
+		if o.Timeout <= 0 {
+			// check at least once
+			o.Timeout = time.Nanosecond
+		}
+
+		err := CheckData(ctx, dbs[0], dbs[i], o)
+		if err != nil {
+			logDivergence(dbs, layout, opts.Diff)
+			return errors.Annotatef(err, "db1 and db%d not converge", i+1)
+		}
+	}
+	return nil
+}
+
+// checkConverge waits until the databases of the workload converge, and records it to the journal.
+// The data is checked after a barrier, so it's usually equal at the first check.
+func (env *Env) checkConverge(ctx context.Context, dbs []*sql.DB) error {
+	entry := &Entry{Round: env.round, Worker: MainWorker, Start: time.Now(), Check: true}
+	err := env.barrier(ctx, dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = CheckConverge(ctx, dbs, env.layout(), env.Check)
+	if err != nil || env.Journal == nil {
+		return errors.Trace(err)
+	}
+	entry.End = time.Now()
+	return errors.Annotate(env.Journal.Record(entry), "record journal")
+}
+
+// logDivergence logs the databases in the minority and the diverged links.
+func logDivergence(dbs []*sql.DB, layout Layout, cfg *diff.Config) {
+	mismatches, err := diff.NewMulti(cfg, dbs...).Equal()
+	if err != nil {
+		log.Warn("find the diverged databases failed", zap.Error(err))
+		return
+	}
+
+	diverged := make(map[[2]int]bool)
+	addGroups := func(groups diff.Groups) {
+		group := make(map[int]int)
+		for g, idxs := range groups {
+			for _, idx := range idxs {
+				group[idx] = g
+			}
+		}
+		for _, link := range layout.Links(len(dbs)) {
+			if group[link[0]] != group[link[1]] {
+				diverged[link] = true
+			}
+		}
+	}
+	for _, tm := range mismatches {
+		var minority []string
+		for _, idx := range tm.Minority() {
+			minority = append(minority, fmt.Sprintf("db%d", idx+1))
+		}
+		log.Warn("table diverged", zap.String("table", tm.Table),
+			zap.Strings("minority", minority),
+			zap.Int("rows", tm.RowCount))
+		addGroups(tm.Groups)
+		for _, row := range tm.Rows {
+			addGroups(row.Groups)
+		}
+	}
+
+	var links [][2]int
+	for _, link := range layout.Links(len(dbs)) {
+		if diverged[link] {
+			links = append(links, link)
+		}
+	}
+	if len(links) > 0 {
+		log.Warn("replication links diverged", zap.String("layout", string(layout)), zap.Strings("links", formatLinks(links)))
+	}
+}
@@ -0,0 +1,107 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// Layout is how the clusters replicate to each other. The workloads always run the DDL on the first
+// cluster, which is the hub of the star.
+type Layout string
+
+// The layouts of the clusters.
+const (
+	// LayoutStar replicates between the first cluster and each of the others.
+	LayoutStar Layout = "star"
+	// LayoutRing replicates from each cluster to the next one, and the last one to the first one.
+	LayoutRing Layout = "ring"
+	// LayoutMesh replicates between every pair of clusters.
+	LayoutMesh Layout = "mesh"
+)
+
+// Validate checks the layout is known.
+func (l Layout) Validate() error {
+	switch l {
+	case LayoutStar, LayoutRing, LayoutMesh:
+		return nil
+	default:
+		return errors.Errorf("unknown layout %s", l)
+	}
+}
+
+// Links returns the replication links between n clusters, a link [i, j] means cluster i replicates to cluster j.
+func (l Layout) Links(n int) [][2]int {
+	var links [][2]int
+	switch l {
+	case LayoutStar:
+		for i := 1; i < n; i++ {
+			links = append(links, [2]int{0, i}, [2]int{i, 0})
+		}
+	case LayoutRing:
+		// the ring of 2 clusters is the same as mesh
+		if n == 2 {
+			return LayoutMesh.Links(n)
+		}
+		for i := 0; i < n; i++ {
+			links = append(links, [2]int{i, (i + 1) % n})
+		}
+	case LayoutMesh:
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				if i != j {
+					links = append(links, [2]int{i, j})
+				}
+			}
+		}
+	}
+	return links
+}
+
+func formatLinks(links [][2]int) []string {
+	strs := make([]string, 0, len(links))
+	for _, link := range links {
+		strs = append(strs, fmt.Sprintf("db%d -> db%d", link[0]+1, link[1]+1))
+	}
+	return strs
+}
+
+// OpenClusters opens the databases with auto_increment_increment n and auto_increment_offset i+1 for the i-th one,
+// so the ids generated by the databases never conflict.
+func OpenClusters(ctx context.Context, dsns []string, p int, session bool) ([]*sql.DB, error) {
+	n := len(dsns)
+	dbs := make([]*sql.DB, 0, n)
+	for i, dsn := range dsns {
+		increment, offset := n, i+1
+		if session {
+			dsn = SessionDSN(dsn, increment, offset)
+		} else {
+			err := SetGlobalVar(ctx, dsn, increment, offset)
+			if err != nil {
+				closeDBs(dbs...)
+				return nil, errors.Trace(err)
+			}
+			log.Info("set global var success", zap.Int("db", i+1), zap.Int("increment", increment), zap.Int("offset", offset))
+		}
+
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			closeDBs(dbs...)
+			return nil, errors.Trace(err)
+		}
+		db.SetMaxIdleConns(p)
+		db.SetMaxOpenConns(p)
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// keySpace returns the k-th (start from 1) key of the cluster idx when each cluster have n keys,
+// the clusters write to their own key space so the writes never conflict.
+func keySpace(idx int, n int64, k int64) int64 {
+	return int64(idx)*n + k
+}
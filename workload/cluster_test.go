@@ -0,0 +1,108 @@
+package workload_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var _ = Suite(&testClusterSuite{})
+
+type testClusterSuite struct{}
+
+func (s *testClusterSuite) TestDMLThreeClusters(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	// the clusters share db1, so the keys written by different clusters conflict unless the key spaces are disjoint
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := workload.OpenJournal(path)
+	c.Assert(err, IsNil)
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0], dsns[0]},
+		Layout:  workload.LayoutRing,
+		P:       2,
+		Session: true,
+		Seed:    1,
+		Journal: journal,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	n := int64(10)
+	err = workload.RunRound(context.Background(), workload.NewDML(workload.DMLOptions{N: n, OpNumber: 100}), env, time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(journal.Close(), IsNil)
+
+	entries, err := workload.ReadJournal(path)
+	c.Assert(err, IsNil)
+	written := make(map[int]int)
+	for _, e := range entries {
+		var uk interface{}
+		switch {
+		case len(e.Args) == 2 && e.SQL == "update auto1 set v = ? where uk = ?":
+			uk = e.Args[1]
+		case len(e.Args) > 0:
+			uk = e.Args[0]
+		default:
+			continue
+		}
+		k, ok := uk.(int64)
+		c.Assert(ok, IsTrue, Commentf("sql: %s", e.SQL))
+		comment := Commentf("cluster %d writes key %d by %s", e.Cluster, k, e.SQL)
+		c.Assert(k > int64(e.Cluster)*n && k <= int64(e.Cluster+1)*n, IsTrue, comment)
+		written[e.Cluster]++
+	}
+	c.Assert(written, HasLen, 3)
+}
+
+func (s *testClusterSuite) TestLogDivergence(c *C) {
+	srv, admin, dsns := startServerWith(c, "db1", "db2", "db3")
+	defer srv.Close()
+	defer admin.Close()
+
+	var dbs []*sql.DB
+	for i, dsn := range dsns {
+		db, err := sql.Open("mysql", dsn)
+		c.Assert(err, IsNil)
+		defer db.Close()
+		stmts := []string{
+			"create table t(id bigint primary key, v bigint)",
+			"insert into t values(1, 1), (2, 2)",
+		}
+		if i == 2 {
+			stmts = append(stmts, "update t set v = 0 where id = 2")
+		}
+		for _, stmt := range stmts {
+			_, err = db.Exec(stmt)
+			c.Assert(err, IsNil)
+		}
+		dbs = append(dbs, db)
+	}
+
+	core, logs := observer.New(zap.WarnLevel)
+	oldLogger, oldProps := log.L(), &log.ZapProperties{}
+	log.ReplaceGlobals(zap.New(core), oldProps)
+	defer log.ReplaceGlobals(oldLogger, oldProps)
+
+	opts := workload.CheckOptions{Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}
+	err := workload.CheckConverge(context.Background(), dbs, workload.LayoutRing, opts)
+	c.Assert(err, ErrorMatches, "db1 and db3 not converge: failed to check equal")
+
+	tables := logs.FilterMessage("table diverged").All()
+	c.Assert(tables, HasLen, 1)
+	fields := tables[0].ContextMap()
+	c.Assert(fields["table"], Equals, "t")
+	c.Assert(fields["minority"], DeepEquals, []interface{}{"db3"})
+	c.Assert(fields["rows"], Equals, int64(1))
+
+	links := logs.FilterMessage("replication links diverged").All()
+	c.Assert(links, HasLen, 1)
+	c.Assert(links[0].ContextMap()["links"], DeepEquals, []interface{}{"db2 -> db3", "db3 -> db1"})
+}
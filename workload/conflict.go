@@ -0,0 +1,337 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// ConflictPolicy is how the replication resolves the conflict writes of a row from different clusters.
+type ConflictPolicy string
+
+// The conflict policies.
+const (
+	// PolicyLWW keeps the write with the largest ts, the last writer wins.
+	PolicyLWW ConflictPolicy = "lww"
+	// PolicySourcePriority keeps the last write of the priority cluster if it wrote the row.
+	PolicySourcePriority ConflictPolicy = "source-priority"
+	// PolicyEither keeps the last write of any cluster, the clusters only need to converge.
+	PolicyEither ConflictPolicy = "either"
+)
+
+// Validate checks the policy is known.
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case PolicyLWW, PolicySourcePriority, PolicyEither:
+		return nil
+	default:
+		return errors.Errorf("unknown conflict policy %s", p)
+	}
+}
+
+// ConflictWrite is a write to a row of the conflict workload.
+type ConflictWrite struct {
+	// Src is the index of the cluster plus 1, 0 for the initial rows.
+	Src int
+	V   int64
+	TS  int64
+}
+
+// Expected returns the values of the row allowed by the policy, lasts is the last write of each cluster to the row,
+// nil if the cluster didn't write it, priority is the index of the priority cluster of PolicySourcePriority.
+// It returns nil if no cluster wrote the row.
+func (p ConflictPolicy) Expected(lasts []*ConflictWrite, priority int) []ConflictWrite {
+	var expected []ConflictWrite
+	switch p {
+	case PolicyLWW:
+		for _, w := range lasts {
+			if w == nil {
+				continue
+			}
+			if len(expected) > 0 && w.TS > expected[0].TS {
+				expected = expected[:0]
+			}
+			if len(expected) == 0 || w.TS == expected[0].TS {
+				expected = append(expected, *w)
+			}
+		}
+		return expected
+	case PolicySourcePriority:
+		if priority < len(lasts) && lasts[priority] != nil {
+			return []ConflictWrite{*lasts[priority]}
+		}
+	}
+
+	for _, w := range lasts {
+		if w != nil {
+			expected = append(expected, *w)
+		}
+	}
+	return expected
+}
+
+// ConflictOptions is the options of Conflict.
+type ConflictOptions struct {
+	// N is how many rows in the table, all the clusters write to them, 0 means DefaultConflictRows.
+	N int64
+	// OpNumber is the number of updates in each cluster, 0 means DefaultConflictOpNumber.
+	OpNumber int64
+	// Policy is the expected conflict policy of the replication, PolicyEither if empty.
+	Policy ConflictPolicy
+	// Priority is the number of the priority cluster of PolicySourcePriority, 1 for db1, 0 means 1.
+	Priority int
+}
+
+// The defaults of ConflictOptions.
+const (
+	DefaultConflictRows     = 1000
+	DefaultConflictOpNumber = 10000
+)
+
+func (o ConflictOptions) withDefault() ConflictOptions {
+	if o.N == 0 {
+		o.N = DefaultConflictRows
+	}
+	if o.OpNumber == 0 {
+		o.OpNumber = DefaultConflictOpNumber
+	}
+	if o.Priority == 0 {
+		o.Priority = 1
+	}
+	return o
+}
+
+// Conflict updates the same rows in all the clusters and checks the converged data follows the conflict policy.
+type Conflict struct {
+	opts ConflictOptions
+
+	dbs []*sql.DB
+	// lasts[i][k] is the last write of the i-th cluster to the row k
+	lasts [][]*ConflictWrite
+}
+
+var _ Workload = &Conflict{}
+
+// NewConflict returns a Conflict workload.
+func NewConflict(opts ConflictOptions) *Conflict {
+	return &Conflict{opts: opts.withDefault()}
+}
+
+func (w *Conflict) Name() string { return "conflict" }
+
+func (w *Conflict) Short() string { return "test the conflict resolution of db1 <-> db2 replication" }
+
+func (w *Conflict) Long() string {
+	return `
+Test the conflict resolution of db1 <-> db2 replication.
+1, create a table in db1 and insert n rows:
+	create table conflict1(id bigint primary key, v bigint, ts bigint, src int);
+
+2, update the rows at random in all the databases concurrently, the same row gets conflict writes from the databases.
+Each write sets v to a random value, ts to the time of the write in nanoseconds, and src to the number of the database.
+
+3, check the databases converge, and each row is the last write of the database expected by the policy:
+	lww: the write with the largest ts.
+	source-priority: the last write of the priority database if it wrote the row, or else the last write of any database.
+	either: the last write of any database.
+	`
+}
+
+func (w *Conflict) Clusters() int { return 2 }
+
+func (w *Conflict) Flags(fs *pflag.FlagSet) {
+	fs.Int64Var(&w.opts.N, "n", DefaultConflictRows, "how many rows in the table")
+	fs.Int64Var(&w.opts.OpNumber, "op-number", DefaultConflictOpNumber, "number of updates in each db")
+	fs.StringVar((*string)(&w.opts.Policy), "policy", string(PolicyEither), "the expected conflict policy: lww, source-priority or either")
+	fs.IntVar(&w.opts.Priority, "priority", 1, "the number of the priority db of the source-priority policy")
+}
+
+func (w *Conflict) policy() ConflictPolicy {
+	if len(w.opts.Policy) == 0 {
+		return PolicyEither
+	}
+	return w.opts.Policy
+}
+
+func (w *Conflict) validateOptions(env *Env) error {
+	if w.opts.N <= 0 {
+		return errors.Errorf("n must be positive, but got %d", w.opts.N)
+	}
+	err := w.policy().Validate()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if w.policy() == PolicySourcePriority && (w.opts.Priority < 1 || w.opts.Priority > len(env.DSNs)) {
+		return errors.Errorf("priority %d is not in [1, %d]", w.opts.Priority, len(env.DSNs))
+	}
+	return nil
+}
+
+func (w *Conflict) Prepare(ctx context.Context, env *Env) error {
+	log.Info("config", zap.Int64("n", w.opts.N),
+		zap.Int64("op-number", w.opts.OpNumber),
+		zap.String("policy", string(w.policy())),
+		zap.Int("priority", w.opts.Priority))
+
+	var err error
+	w.dbs, err = OpenClusters(ctx, env.DSNs, env.P, env.Session)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	e := env.Execer(w.dbs[0], 0, MainWorker)
+	_, err = e.ExecContext(ctx, "drop table if exists conflict1")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = e.ExecContext(ctx, "create table conflict1(id bigint primary key, v bigint, ts bigint, src int)")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = env.checkConverge(ctx, w.dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	var eg errgroup.Group
+	for i := 0; i < env.P; i++ {
+		i, e := i, env.Execer(w.dbs[0], 0, i)
+		eg.Go(func() error {
+			for k := int64(i) + 1; k <= w.opts.N; k += int64(env.P) {
+				_, err := e.ExecContext(ctx, "insert into conflict1(id, v, ts, src) values(?, ?, 0, 0)", k, k)
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
+		})
+	}
+	err = eg.Wait()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(env.checkConverge(ctx, w.dbs))
+}
+
+// Run updates the rows in every database, the i-th worker of each database updates the rows i+1, i+1+p...
+// so the writes of a database to a row are in order, and the writes of different databases conflict.
+// There are p workers in each database, or n if less rows than p.
+func (w *Conflict) Run(ctx context.Context, env *Env) error {
+	w.lasts = make([][]*ConflictWrite, len(w.dbs))
+	for i := range w.lasts {
+		w.lasts[i] = make([]*ConflictWrite, w.opts.N+1)
+	}
+
+	workers := int64(env.P)
+	if w.opts.N < workers {
+		workers = w.opts.N
+	}
+	if workers == 0 {
+		return nil
+	}
+	var eg errgroup.Group
+	for idx, db := range w.dbs {
+		for i := int64(0); i < workers; i++ {
+			idx, i, e := idx, i, env.Execer(db, idx, int(i))
+			rnd := env.Rand(idx, int(i))
+			rows := (w.opts.N - i + workers - 1) / workers
+			ops := w.opts.OpNumber / workers
+			if i < w.opts.OpNumber%workers {
+				ops++
+			}
+
+			eg.Go(func() error {
+				for ; ops > 0; ops-- {
+					k := i + 1 + rnd.Int63n(rows)*workers
+					write := &ConflictWrite{Src: idx + 1, V: rnd.Int63(), TS: time.Now().UnixNano()}
+					_, err := e.ExecContext(ctx, "update conflict1 set v = ?, ts = ?, src = ? where id = ?", write.V, write.TS, write.Src, k)
+					if err != nil {
+						return errors.Trace(err)
+					}
+					// only the worker writes the row in this database
+					w.lasts[idx][k] = write
+				}
+				return nil
+			})
+		}
+	}
+	return errors.Trace(eg.Wait())
+}
+
+func (w *Conflict) Verify(ctx context.Context, env *Env) error {
+	err := env.checkConverge(ctx, w.dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	rows, err := w.dbs[0].QueryContext(ctx, "select id, v, ts, src from conflict1")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	var count int64
+	var violations []string
+	lasts := make([]*ConflictWrite, len(w.dbs))
+	for rows.Next() {
+		var k int64
+		var got ConflictWrite
+		err = rows.Scan(&k, &got.V, &got.TS, &got.Src)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		count++
+		if k < 1 || k > w.opts.N {
+			violations = append(violations, fmt.Sprintf("unexpected row %d", k))
+			continue
+		}
+
+		for i := range lasts {
+			lasts[i] = w.lasts[i][k]
+		}
+		expected := w.policy().Expected(lasts, w.opts.Priority-1)
+		if expected == nil {
+			expected = []ConflictWrite{{V: k}}
+		}
+		if !containsWrite(expected, got) {
+			violations = append(violations, fmt.Sprintf("row %d is %+v, expected one of %+v", k, got, expected))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+	if count != w.opts.N {
+		violations = append(violations, fmt.Sprintf("%d rows, expected %d", count, w.opts.N))
+	}
+
+	if len(violations) > 0 {
+		for _, v := range violations {
+			log.Warn("violate conflict policy", zap.String("policy", string(w.policy())), zap.String("violation", v))
+		}
+		return errors.Errorf("%d rows violate the conflict policy %s, like %s", len(violations), w.policy(), violations[0])
+	}
+	return nil
+}
+
+func containsWrite(writes []ConflictWrite, w ConflictWrite) bool {
+	for _, write := range writes {
+		if write == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Conflict) Cleanup(ctx context.Context, env *Env) error {
+	closeDBs(w.dbs...)
+	w.dbs = nil
+	w.lasts = nil
+	return nil
+}
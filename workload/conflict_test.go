@@ -0,0 +1,58 @@
+package workload_test
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testConflictSuite{})
+
+type testConflictSuite struct{}
+
+// tamperedConflict changes a row before verifying.
+type tamperedConflict struct {
+	*workload.Conflict
+	admin *sql.DB
+}
+
+func (w *tamperedConflict) Verify(ctx context.Context, env *workload.Env) error {
+	_, err := w.admin.Exec("update db1.conflict1 set v = 0, ts = 1, src = 1 where id = 3")
+	if err != nil {
+		return err
+	}
+	return w.Conflict.Verify(ctx, env)
+}
+
+func (s *testConflictSuite) TestConflict(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	// both of the clusters are db1, so the writes are replicated at once and the last committed one wins
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0]},
+		P:       4,
+		Session: true,
+		Seed:    1,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	w := workload.NewConflict(workload.ConflictOptions{N: 10, OpNumber: 200, Policy: workload.PolicyEither})
+	c.Assert(workload.RunRound(context.Background(), w, env, time.Minute), IsNil)
+
+	// a row not written by any cluster violates the policy
+	tampered := &tamperedConflict{Conflict: workload.NewConflict(workload.ConflictOptions{N: 10, OpNumber: 200}), admin: admin}
+	err := workload.RunRound(context.Background(), tampered, env, time.Minute)
+	c.Assert(err, ErrorMatches, "verify failed: 1 rows violate the conflict policy either, like row 3 is .*")
+
+	w = workload.NewConflict(workload.ConflictOptions{N: 10, OpNumber: 200, Policy: "first"})
+	err = workload.RunRound(context.Background(), w, env, time.Minute)
+	c.Assert(err, ErrorMatches, "unknown conflict policy first")
+
+	w = workload.NewConflict(workload.ConflictOptions{N: 10, OpNumber: 200, Policy: workload.PolicySourcePriority, Priority: 3})
+	err = workload.RunRound(context.Background(), w, env, time.Minute)
+	c.Assert(err, ErrorMatches, `priority 3 is not in \[1, 2\]`)
+}
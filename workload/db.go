@@ -0,0 +1,145 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	// register the mysql driver for sql.Open
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// SessionDSN returns dsn with auto_increment_increment and auto_increment_offset set as session variables.
+func SessionDSN(dsn string, increment int, offset int) string {
+	return dsn + fmt.Sprintf("&auto_increment_increment=%d&auto_increment_offset=%d", increment, offset)
+}
+
+// SetGlobalVar sets the global auto_increment_increment and auto_increment_offset, and checks
+// a new connection gets them.
+func SetGlobalVar(ctx context.Context, dsn string, increment int, offset int) error {
+	var err error
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("SET @@GLOBAL.auto_increment_increment = %d;", increment))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("SET @@GLOBAL.auto_increment_offset = %d;", offset))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// see https://github.com/pingcap/tidb/issues/14531#issuecomment-575982919
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-time.After(time.Second * 3):
+	}
+	// check value for new connection
+	db.Close()
+	db2, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	defer db2.Close()
+
+	var v int
+	row := db2.QueryRowContext(ctx, "SELECT @@auto_increment_increment;")
+	err = row.Scan(&v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if v != increment {
+		return errors.Errorf("increment get: %d after set as: %d", v, increment)
+	}
+
+	row = db2.QueryRowContext(ctx, "SELECT @@auto_increment_offset;")
+	err = row.Scan(&v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if v != offset {
+		return errors.Errorf("offset get: %d after set as: %d", v, offset)
+	}
+
+	return nil
+}
+
+func closeDBs(dbs ...*sql.DB) {
+	for _, db := range dbs {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+// execer is *sql.DB or *Execer.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func setupAutoIncrementAndOffset(ctx context.Context, db execer) error {
+	var err error
+	_, err = db.ExecContext(ctx, "drop table if exists auto1;")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err = db.ExecContext(ctx, "create table auto1(id bigint primary key auto_increment, uk bigint unique key, v bigint);")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+func cleanupAutoIncrementAndOffset(ctx context.Context, db execer) error {
+	_, err := db.ExecContext(ctx, "drop table if exists auto1;")
+	return errors.Trace(err)
+}
+
+// loadAutoIncrementAndOffset inserts n rows into the key space of the idx-th database,
+// the i-th of the env.P workers inserts the rows i, i+p, i+2p...
+func loadAutoIncrementAndOffset(ctx context.Context, env *Env, db *sql.DB, idx int, n int64) error {
+	p := env.P
+	db.SetMaxIdleConns(p)
+	db.SetMaxOpenConns(p)
+
+	var eg errgroup.Group
+
+	for i := 0; i < p; i++ {
+		i, e := i, env.Execer(db, idx, i)
+		eg.Go(func() error {
+			for v := int64(i); v < n; v += int64(p) {
+				uk := keySpace(idx, n, v+1)
+
+				_, err := e.ExecContext(ctx, "insert into auto1(uk,v) values(?,?)", uk, v)
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("finish load data", zap.Int64("number", n))
+	return nil
+}
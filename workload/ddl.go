@@ -0,0 +1,175 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// DDL keeps inserting and do random add -> change(int -> bigint) -> drop column.
+type DDL struct {
+	dbs []*sql.DB
+}
+
+var _ Workload = &DDL{}
+
+// NewDDL returns a DDL workload.
+func NewDDL() *DDL {
+	return &DDL{}
+}
+
+func (w *DDL) Name() string { return "ddl" }
+
+func (w *DDL) Short() string { return "test DDL and DML concurrently" }
+
+func (w *DDL) Long() string {
+	return `
+	test some DDL and DML currently and data still consistent finally.
+	will add/drop/change column now
+`
+}
+
+func (w *DDL) Clusters() int { return 2 }
+
+func (w *DDL) Prepare(ctx context.Context, env *Env) error {
+	var err error
+	w.dbs, err = OpenClusters(ctx, env.DSNs, env.P, env.Session)
+	return errors.Trace(err)
+}
+
+// Run checks the data after each DDL, so there's nothing left to Verify.
+func (w *DDL) Run(ctx context.Context, env *Env) error {
+	columnTypes := []string{" int default 1", " int not null"}
+	rnd := env.Rand()
+
+	// step identifies the random sources of the inserting workers for each DDL
+	step := 0
+	for _, cType := range columnTypes {
+		cName := "c" + strconv.Itoa(rnd.Intn(1000))
+		// setup table on db1
+		err := setupAutoIncrementAndOffset(ctx, env.Execer(w.dbs[0], 0, MainWorker))
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		// the table will replicate to the others
+		err = env.checkConverge(ctx, w.dbs)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		// add column
+		step++
+		err = w.runDDLWithInsert(ctx, env, step, cName, fmt.Sprintf("alter table auto1 add column %s %s;", cName, cType))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("pass check data equal after add column")
+
+		// change column int -> bigint
+		step++
+		err = w.runDDLWithInsert(ctx, env, step, cName, fmt.Sprintf("alter table auto1 modify column %s %s;", cName, strings.Replace(cType, "int", "bigint", -1)))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("pass check data equal after change column")
+
+		// drop column
+		step++
+		err = w.runDDLWithInsert(ctx, env, step, cName, fmt.Sprintf("alter table auto1 drop column %s;", cName))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("pass check data equal after drop column")
+	}
+
+	return nil
+}
+
+// runDDLWithInsert runs the ddl on db1 while keep inserting into all the databases, then checks data converge.
+// The ddl runs after all the workers have inserted, and the workers keep inserting until the ddl is replicated
+// to all the databases by a barrier, so there are inserts before and after the ddl in each database.
+func (w *DDL) runDDLWithInsert(ctx context.Context, env *Env, step int, cName string, ddl string) error {
+	stop := make(chan struct{})
+	var started sync.WaitGroup
+	var eg errgroup.Group
+	for i := 0; i < env.P; i++ {
+		for idx, db := range w.dbs {
+			e, rnd := env.Execer(db, idx, i), env.Rand(step, idx, i)
+			started.Add(1)
+			eg.Go(func() error {
+				var once sync.Once
+				// in case it fails before the first insert
+				defer once.Do(started.Done)
+				return keepInsert(ctx, e, rnd, cName, func() { once.Do(started.Done) }, stop)
+			})
+		}
+	}
+	started.Wait()
+
+	_, err := env.Execer(w.dbs[0], 0, MainWorker).ExecContext(ctx, ddl)
+	if err == nil {
+		log.Info("run ddl success", zap.String("sql", ddl))
+		err = env.barrier(ctx, w.dbs)
+	}
+	close(stop)
+	if werr := eg.Wait(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(env.checkConverge(ctx, w.dbs))
+}
+
+// keepInsert inserts rows with and without the column cName until stop is closed or ctx is done, inserted is
+// called after each round of inserts.
+func keepInsert(ctx context.Context, e *Execer, rnd *rand.Rand, cName string, inserted func(), stop chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		default:
+		}
+
+		_, err := e.ExecContext(ctx, "insert into auto1(v) values(?)", rnd.Int31())
+		if err != nil {
+			// ERROR 1364 (HY000): Field 'c1' doesn't have a default value)
+			// ignore doesn't have default value
+			if !strings.Contains(err.Error(), "have a default value") {
+				return err
+			}
+		}
+
+		_, err = e.ExecContext(ctx, fmt.Sprintf("insert into auto1(v, %s) values(?, ?)", cName), rnd.Int31(), rnd.Int31())
+		if err != nil {
+			// ignore unknown column
+			if !strings.Contains(err.Error(), "unknown column") {
+				return err
+			}
+		}
+		inserted()
+	}
+}
+
+func (w *DDL) Verify(ctx context.Context, env *Env) error {
+	return nil
+}
+
+func (w *DDL) Cleanup(ctx context.Context, env *Env) error {
+	closeDBs(w.dbs...)
+	w.dbs = nil
+	return nil
+}
@@ -0,0 +1,179 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// DMLOptions is the options of DML.
+type DMLOptions struct {
+	// N is how many rows to fill the table, 0 means DefaultDMLRows.
+	N int64
+	// OpNumber is the number of random insert/update/delete after filling N rows, 0 means DefaultDMLOpNumber.
+	OpNumber int64
+}
+
+// The defaults of DMLOptions.
+const (
+	DefaultDMLRows     = 10000
+	DefaultDMLOpNumber = 10000
+)
+
+func (o DMLOptions) withDefault() DMLOptions {
+	if o.N == 0 {
+		o.N = DefaultDMLRows
+	}
+	if o.OpNumber == 0 {
+		o.OpNumber = DefaultDMLOpNumber
+	}
+	return o
+}
+
+// DML tests the correctness of dml replication between the databases.
+type DML struct {
+	opts DMLOptions
+
+	dbs []*sql.DB
+}
+
+var _ Workload = &DML{}
+
+// NewDML returns a DML workload.
+func NewDML(opts DMLOptions) *DML {
+	return &DML{opts: opts.withDefault()}
+}
+
+func (w *DML) Name() string { return "dml" }
+
+func (w *DML) Short() string { return "test correctness of db1 <-> db2 dml replication" }
+
+func (w *DML) Long() string {
+	return `
+Test correctness of db1 <-> db2 dml replication
+Will run all DDL in db1 and let it replicate ddl to db2, so *sync-ddl* should be false in db2.
+1, create a table:
+	create table auto1(id bigint primary key auto_increment, uk bigint unique key, v bigint);
+
+2, insert n rows with specified increment and offset setted while global or session in both db1 and db2, then check data equal between db1 and db2.
+
+3, try at most op-number random insert/update/delete in both db1 and db2, then check data equal between db1 and db2.
+
+if loop is true will run again and again unless meet some error.
+
+With more than 2 databases from the topology, the increment is the number of databases and the offset of dbN is N,
+each database writes its own range of uk, and every pair of databases must converge.
+	`
+}
+
+func (w *DML) Clusters() int { return 2 }
+
+func (w *DML) Flags(fs *pflag.FlagSet) {
+	fs.Int64Var(&w.opts.N, "n", DefaultDMLRows, "how many rows fill up table")
+	fs.Int64Var(&w.opts.OpNumber, "op-number", DefaultDMLOpNumber, "random number of Insert/Update/delete after filling n rows")
+}
+
+func (w *DML) validateOptions(env *Env) error {
+	if w.opts.N <= 0 {
+		return errors.Errorf("n must be positive, but got %d", w.opts.N)
+	}
+	return nil
+}
+
+func (w *DML) Prepare(ctx context.Context, env *Env) error {
+	log.Info("config", zap.Int64("n", w.opts.N), zap.Int64("op-number", w.opts.OpNumber))
+
+	var err error
+	w.dbs, err = OpenClusters(ctx, env.DSNs, env.P, env.Session)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// setup table on db1
+	err = setupAutoIncrementAndOffset(ctx, env.Execer(w.dbs[0], 0, MainWorker))
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// the table will replicate to the others, the barrier makes sure the drop and create of the table are
+	// replicated before the diff, or else it may see the old table dropped while checking it.
+	err = env.checkConverge(ctx, w.dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// fill n row
+	for i, db := range w.dbs {
+		err = loadAutoIncrementAndOffset(ctx, env, db, i, w.opts.N)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// check data equal
+	return errors.Trace(env.checkConverge(ctx, w.dbs))
+}
+
+// Run does opNumber random insert/delete/update in every database.
+func (w *DML) Run(ctx context.Context, env *Env) error {
+	var eg errgroup.Group
+	for i, db := range w.dbs {
+		i, db := i, db
+		eg.Go(func() error {
+			return w.doOp(ctx, env, db, i)
+		})
+	}
+	return errors.Trace(eg.Wait())
+}
+
+// doOp does opNumber random insert/delete/update in the key space of the idx-th database.
+// The ops are split evenly to the workers, each worker has its own random source from env,
+// so the same seed produces the same ops for each worker.
+func (w *DML) doOp(ctx context.Context, env *Env, db *sql.DB, idx int) error {
+	n, p := w.opts.N, env.P
+	var eg errgroup.Group
+	for i := 0; i < p; i++ {
+		ops := w.opts.OpNumber / int64(p)
+		if int64(i) < w.opts.OpNumber%int64(p) {
+			ops++
+		}
+		rnd, e := env.Rand(idx, i), env.Execer(db, idx, i)
+		eg.Go(func() error {
+			for ; ops > 0; ops-- {
+				v := rnd.Int()
+				uk := keySpace(idx, n, rnd.Int63n(n)+1)
+
+				var err error
+				switch rnd.Intn(3) {
+				case 0: // try insert
+					_, err = e.ExecContext(ctx, "replace into auto1(uk, v) values(?, ?)", uk, v)
+				case 1: // try update
+					_, err = e.ExecContext(ctx, "update auto1 set v = ? where uk = ?", v, uk)
+				case 2: // try delete
+					_, err = e.ExecContext(ctx, "delete from auto1 where uk = ?", uk)
+				}
+				if err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
+
+func (w *DML) Verify(ctx context.Context, env *Env) error {
+	return errors.Trace(env.checkConverge(ctx, w.dbs))
+}
+
+func (w *DML) Cleanup(ctx context.Context, env *Env) error {
+	closeDBs(w.dbs...)
+	w.dbs = nil
+	return nil
+}
@@ -0,0 +1,344 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/july2993/bitest/diff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultHeartbeatDatabase is the database of the heartbeat table, it's not the database of the workloads,
+// so the heartbeats don't make the data checks fail.
+const DefaultHeartbeatDatabase = "bitest"
+
+// errUnknownDatabase is the error number of MySQL when the database does not exist.
+const errUnknownDatabase = 1049
+
+// HeartbeatOptions is how to measure the replication lag by heartbeats.
+type HeartbeatOptions struct {
+	// Interval is the interval between two heartbeats of a cluster, 0 disables the heartbeats.
+	Interval time.Duration
+	// SLO fails the run if a heartbeat is replicated slower than it, 0 means no SLO.
+	SLO time.Duration
+	// Sources are the index of the clusters writing the heartbeats, nil means all the clusters.
+	Sources []int
+	// Database is the database of the heartbeat table, DefaultHeartbeatDatabase if empty.
+	Database string
+}
+
+// LagStats is the distribution of the replication lag from a cluster to another.
+type LagStats struct {
+	// From and To are the index of the clusters.
+	From  int
+	To    int
+	Count int
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// Direction returns the direction like "db1 -> db2".
+func (s LagStats) Direction() string {
+	return fmt.Sprintf("db%d -> db%d", s.From+1, s.To+1)
+}
+
+// Heartbeat writes the rows of (cluster, seq, ts) to each source cluster every interval, and reads them in the
+// other clusters to measure the replication lag. The lag is measured when a heartbeat is read, so it's at most
+// Interval/10 more than the real one.
+type Heartbeat struct {
+	opts  HeartbeatOptions
+	table string
+	dbs   []*sql.DB
+
+	cancel context.CancelFunc
+	eg     *errgroup.Group
+
+	mu sync.Mutex
+	// written[i] is the time of the heartbeats of the i-th cluster, the seq starts from 1
+	written [][]time.Time
+	// seen[i][j] is the max seq of the i-th cluster read in the j-th cluster
+	seen [][]int64
+	lags map[[2]int][]time.Duration
+	// maxLag is the max of lags of each direction
+	maxLag map[[2]int]time.Duration
+}
+
+// StartHeartbeat creates the heartbeat table in the first cluster and starts the heartbeats. The SLO is checked
+// until Stop, including the heartbeats not replicated yet, onFail is called once at the first violation of the
+// SLO or failure of the heartbeats.
+func StartHeartbeat(ctx context.Context, dsns []string, opts HeartbeatOptions, onFail func(err error)) (*Heartbeat, error) {
+	if opts.Interval <= 0 {
+		return nil, errors.New("heartbeat interval must be positive")
+	}
+	if len(opts.Database) == 0 {
+		opts.Database = DefaultHeartbeatDatabase
+	}
+	if opts.Sources == nil {
+		for i := range dsns {
+			opts.Sources = append(opts.Sources, i)
+		}
+	}
+	for _, src := range opts.Sources {
+		if src < 0 || src >= len(dsns) {
+			return nil, errors.Errorf("heartbeat source db%d not exist", src+1)
+		}
+	}
+
+	h := &Heartbeat{
+		opts:    opts,
+		table:   fmt.Sprintf("`%s`.`heartbeat`", opts.Database),
+		written: make([][]time.Time, len(dsns)),
+		seen:    make([][]int64, len(dsns)),
+		lags:    make(map[[2]int][]time.Duration),
+		maxLag:  make(map[[2]int]time.Duration),
+	}
+	for i := range h.seen {
+		h.seen[i] = make([]int64, len(dsns))
+	}
+	for _, dsn := range dsns {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			closeDBs(h.dbs...)
+			return nil, errors.Trace(err)
+		}
+		h.dbs = append(h.dbs, db)
+	}
+
+	for _, stmt := range []string{
+		fmt.Sprintf("create database if not exists `%s`", opts.Database),
+		fmt.Sprintf("drop table if exists %s", h.table),
+		fmt.Sprintf("create table %s(cluster int, seq bigint, ts bigint, primary key(cluster, seq))", h.table),
+	} {
+		_, err := h.dbs[0].ExecContext(ctx, stmt)
+		if err != nil {
+			closeDBs(h.dbs...)
+			return nil, errors.Trace(err)
+		}
+	}
+
+	ctx, h.cancel = context.WithCancel(ctx)
+	h.eg, ctx = errgroup.WithContext(ctx)
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			log.Warn("heartbeat failed", zap.Error(err))
+			if onFail != nil {
+				onFail(err)
+			}
+		})
+	}
+	for _, src := range opts.Sources {
+		src := src
+		h.eg.Go(func() error { return h.keepWrite(ctx, src) })
+	}
+	for dst := range h.dbs {
+		dst := dst
+		h.eg.Go(func() error {
+			err := h.keepRead(ctx, dst, fail)
+			if err != nil {
+				fail(err)
+			}
+			return err
+		})
+	}
+	log.Info("start heartbeat", zap.Duration("interval", opts.Interval),
+		zap.Duration("slo", opts.SLO),
+		zap.Ints("sources", opts.Sources),
+		zap.String("table", h.table))
+	return h, nil
+}
+
+// keepWrite writes the heartbeats of the src-th cluster until ctx is done.
+func (h *Heartbeat) keepWrite(ctx context.Context, src int) error {
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+
+	for seq := int64(1); ; {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		ts := time.Now()
+		_, err := h.dbs[src].ExecContext(ctx, fmt.Sprintf("insert into %s(cluster, seq, ts) values(?, ?, ?)", h.table), src, seq, ts.UnixNano())
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// the heartbeats are not replicated, the failure is only logged
+			log.Warn("write heartbeat failed", zap.Int("db", src+1), zap.Int64("seq", seq), zap.Error(err))
+			continue
+		}
+
+		h.mu.Lock()
+		h.written[src] = append(h.written[src], ts)
+		h.mu.Unlock()
+		seq++
+	}
+}
+
+// keepRead reads the heartbeats of the other clusters in the dst-th cluster until ctx is done.
+func (h *Heartbeat) keepRead(ctx context.Context, dst int, violate func(err error)) error {
+	interval := h.opts.Interval / 10
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		err := h.read(ctx, dst)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// the heartbeat table is not replicated yet without the database
+			if !diff.IsRetryableError(err) && !isUnknownDatabase(err) {
+				return errors.Annotatef(err, "read heartbeat in db%d", dst+1)
+			}
+			log.Debug("read heartbeat failed, will read again", zap.Int("db", dst+1), zap.Error(err))
+		}
+
+		if h.opts.SLO > 0 {
+			if err = h.checkSLO(dst, time.Now()); err != nil {
+				violate(err)
+			}
+		}
+	}
+}
+
+// isUnknownDatabase returns true if the database of the heartbeat table does not exist.
+func isUnknownDatabase(err error) bool {
+	myErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && myErr.Number == errUnknownDatabase
+}
+
+func (h *Heartbeat) read(ctx context.Context, dst int) error {
+	rows, err := h.dbs[dst].QueryContext(ctx, fmt.Sprintf("select cluster, max(seq) from %s group by cluster", h.table))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for rows.Next() {
+		var src int
+		var seq int64
+		err = rows.Scan(&src, &seq)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if src == dst || src < 0 || src >= len(h.written) {
+			continue
+		}
+
+		// the heartbeat may be read before it's recorded as written, it's read again next time
+		if int64(len(h.written[src])) < seq {
+			seq = int64(len(h.written[src]))
+		}
+		key := [2]int{src, dst}
+		for s := h.seen[src][dst] + 1; s <= seq; s++ {
+			lag := now.Sub(h.written[src][s-1])
+			h.lags[key] = append(h.lags[key], lag)
+			if lag > h.maxLag[key] {
+				h.maxLag[key] = lag
+			}
+		}
+		if seq > h.seen[src][dst] {
+			h.seen[src][dst] = seq
+		}
+	}
+	return errors.Trace(rows.Err())
+}
+
+// checkSLO checks the heartbeats replicated to dst and the ones not replicated yet are in the SLO.
+func (h *Heartbeat) checkSLO(dst int, now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, src := range h.opts.Sources {
+		if src == dst {
+			continue
+		}
+		seen := h.seen[src][dst]
+		if lag := h.maxLag[[2]int{src, dst}]; lag > h.opts.SLO {
+			return errors.Errorf("db%d -> db%d max lag %s exceeds slo %s", src+1, dst+1, lag, h.opts.SLO)
+		}
+		if int64(len(h.written[src])) > seen {
+			if lag := now.Sub(h.written[src][seen]); lag > h.opts.SLO {
+				return errors.Errorf("db%d -> db%d heartbeat %d not replicated after %s, exceeds slo %s", src+1, dst+1, seen+1, lag, h.opts.SLO)
+			}
+		}
+	}
+	return nil
+}
+
+// Stats returns the lag distribution of each direction so far.
+func (h *Heartbeat) Stats() []LagStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var stats []LagStats
+	for _, src := range h.opts.Sources {
+		for dst := range h.dbs {
+			if src == dst {
+				continue
+			}
+			lags := append([]time.Duration(nil), h.lags[[2]int{src, dst}]...)
+			sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+			s := LagStats{From: src, To: dst, Count: len(lags)}
+			if len(lags) > 0 {
+				s.P50 = quantile(lags, 0.5)
+				s.P99 = quantile(lags, 0.99)
+				s.Max = lags[len(lags)-1]
+			}
+			stats = append(stats, s)
+		}
+	}
+	return stats
+}
+
+// quantile returns the q quantile of the sorted durations.
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	idx := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// Stop stops the heartbeats and logs the lag distribution of each direction.
+func (h *Heartbeat) Stop() ([]LagStats, error) {
+	h.cancel()
+	err := h.eg.Wait()
+	closeDBs(h.dbs...)
+
+	stats := h.Stats()
+	for _, s := range stats {
+		log.Info("replication lag", zap.String("direction", s.Direction()),
+			zap.Int("heartbeats", s.Count),
+			zap.Duration("p50", s.P50),
+			zap.Duration("p99", s.P99),
+			zap.Duration("max", s.Max))
+	}
+	return stats, errors.Trace(err)
+}
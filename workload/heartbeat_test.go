@@ -0,0 +1,70 @@
+package workload_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testHeartbeatSuite{})
+
+type testHeartbeatSuite struct{}
+
+func (s *testHeartbeatSuite) TestHeartbeat(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	// both of the clusters are db1, so the heartbeats are replicated at once
+	opts := workload.HeartbeatOptions{Interval: 10 * time.Millisecond, SLO: time.Minute}
+	hb, err := workload.StartHeartbeat(context.Background(), []string{dsns[0], dsns[0]}, opts, func(err error) {
+		c.Errorf("violate slo: %v", err)
+	})
+	c.Assert(err, IsNil)
+	time.Sleep(200 * time.Millisecond)
+	stats, err := hb.Stop()
+	c.Assert(err, IsNil)
+	c.Assert(stats, HasLen, 2)
+	c.Assert(stats[0].Direction(), Equals, "db1 -> db2")
+	c.Assert(stats[1].Direction(), Equals, "db2 -> db1")
+	for _, s := range stats {
+		c.Assert(s.Count > 0, IsTrue)
+		c.Assert(s.P50 <= s.P99 && s.P99 <= s.Max, IsTrue)
+		c.Assert(s.Max < time.Second, IsTrue)
+	}
+
+	_, err = workload.StartHeartbeat(context.Background(), dsns, workload.HeartbeatOptions{Interval: time.Second, Sources: []int{2}}, nil)
+	c.Assert(err, ErrorMatches, "heartbeat source db3 not exist")
+}
+
+func (s *testHeartbeatSuite) TestHeartbeatSLO(c *C) {
+	srv1, admin1, dsns1 := startServer(c)
+	defer srv1.Close()
+	defer admin1.Close()
+	srv2, admin2, dsns2 := startServer(c)
+	defer srv2.Close()
+	defer admin2.Close()
+
+	// the heartbeats of db1 never reach db2 on another server
+	env := &workload.Env{
+		DSNs:      []string{dsns1[0], dsns2[0]},
+		P:         1,
+		Heartbeat: workload.HeartbeatOptions{Interval: 10 * time.Millisecond, SLO: 50 * time.Millisecond, Sources: []int{0}},
+	}
+	w := &fakeWorkload{hangAt: "run"}
+	err := workload.Run(context.Background(), w, env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "heartbeat: db1 -> db2 heartbeat 1 not replicated after .*, exceeds slo 50ms")
+	c.Assert(w.steps, DeepEquals, []string{"prepare", "run", "cleanup"})
+}
+
+func (s *testHeartbeatSuite) TestHeartbeatWithoutInterval(c *C) {
+	for _, opts := range []workload.HeartbeatOptions{{SLO: time.Second}, {Sources: []int{0}}} {
+		env := &workload.Env{DSNs: []string{"dsn1", "dsn2"}, P: 1, Heartbeat: opts}
+		w := &fakeWorkload{}
+		err := workload.Run(context.Background(), w, env, workload.RunOptions{})
+		c.Assert(err, ErrorMatches, "the lag slo and sources of the heartbeats need the heartbeat interval")
+		c.Assert(w.steps, HasLen, 0)
+	}
+}
@@ -0,0 +1,192 @@
+package workload
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// Entry is a statement recorded in the journal.
+type Entry struct {
+	// Round is the round of Run, 0 if run by RunRound directly.
+	Round int `json:"round,omitempty"`
+	// Cluster is the index of the database in Env.DSNs, 0 for db1.
+	Cluster int `json:"cluster"`
+	// Worker is the id of the worker in the cluster who runs the statement, MainWorker if it's not
+	// run by a worker, like the DDL.
+	Worker       int           `json:"worker"`
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	SQL          string        `json:"sql"`
+	Args         []interface{} `json:"args,omitempty"`
+	RowsAffected int64         `json:"rows-affected"`
+	LastInsertID int64         `json:"last-insert-id"`
+	Err          string        `json:"error,omitempty"`
+	// Check is true if the workload waited for the databases to converge instead of running a statement,
+	// the entries after it wait for it too when replaying.
+	Check bool `json:"check,omitempty"`
+}
+
+// Journal records the statements of the workloads to a file, an entry of JSON per line.
+// It's safe for concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+// OpenJournal creates or truncates the journal file of path.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	w := bufio.NewWriter(file)
+	return &Journal{file: file, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// Record appends e to the journal.
+func (j *Journal) Record(e *Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return errors.Trace(j.enc.Encode(e))
+}
+
+// Flush writes the buffered entries to the file.
+func (j *Journal) Flush() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return errors.Trace(j.w.Flush())
+}
+
+// Close flushes and closes the journal file.
+func (j *Journal) Close() error {
+	err := j.Flush()
+	if cerr := j.file.Close(); err == nil {
+		err = errors.Trace(cerr)
+	}
+	return err
+}
+
+// WriteJournal writes entries to the journal file of path, like the minimized entries.
+func WriteJournal(path string, entries []Entry) error {
+	j, err := OpenJournal(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i := range entries {
+		if err = j.Record(&entries[i]); err != nil {
+			j.Close()
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(j.Close())
+}
+
+// MainWorker is the worker id of the statements run by the workload itself instead of its workers.
+const MainWorker = -1
+
+// Execer executes the statements of a worker on a database, and records them to the journal of Env if set.
+type Execer struct {
+	db      *sql.DB
+	journal *Journal
+	round   int
+	cluster int
+	worker  int
+}
+
+// Execer returns the Execer of the worker on db, which is the cluster-th database of env.
+func (env *Env) Execer(db *sql.DB, cluster int, worker int) *Execer {
+	return &Execer{db: db, journal: env.Journal, round: env.round, cluster: cluster, worker: worker}
+}
+
+// ExecContext executes the statement like sql.DB.ExecContext, the failure of recording is returned
+// only if the statement succeeds.
+func (e *Execer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if e.journal == nil {
+		return e.db.ExecContext(ctx, query, args...)
+	}
+
+	res, entry, err := e.exec(ctx, e.db, query, args)
+	if jerr := e.journal.Record(entry); jerr != nil && err == nil {
+		return res, errors.Annotate(jerr, "record journal")
+	}
+	return res, err
+}
+
+// exec executes the statement on db and returns the entry of it.
+func (e *Execer) exec(ctx context.Context, db execer, query string, args []interface{}) (sql.Result, *Entry, error) {
+	entry := &Entry{
+		Round:   e.round,
+		Cluster: e.cluster,
+		Worker:  e.worker,
+		Start:   time.Now(),
+		SQL:     query,
+		Args:    args,
+	}
+	res, err := db.ExecContext(ctx, query, args...)
+	entry.End = time.Now()
+	if err != nil {
+		entry.Err = err.Error()
+	} else {
+		// the driver of mysql never fails to get them
+		entry.RowsAffected, _ = res.RowsAffected()
+		entry.LastInsertID, _ = res.LastInsertId()
+	}
+	return res, entry, err
+}
+
+// BeginTx starts a transaction of the worker like sql.DB.BeginTx.
+func (e *Execer) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxExecer, error) {
+	tx, err := e.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &TxExecer{e: e, tx: tx}, nil
+}
+
+// TxExecer executes the statements of a transaction like Execer. The statements are recorded to the journal
+// when the transaction commits, as a rolled back one changes nothing, so they're replayed without the transaction.
+type TxExecer struct {
+	e       *Execer
+	tx      *sql.Tx
+	entries []*Entry
+}
+
+// ExecContext executes the statement in the transaction like sql.Tx.ExecContext.
+func (t *TxExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if t.e.journal == nil {
+		return t.tx.ExecContext(ctx, query, args...)
+	}
+
+	res, entry, err := t.e.exec(ctx, t.tx, query, args)
+	t.entries = append(t.entries, entry)
+	return res, err
+}
+
+// Commit commits the transaction and records its statements, the failure of recording is returned
+// only if the commit succeeds.
+func (t *TxExecer) Commit() error {
+	err := t.tx.Commit()
+	if err != nil || t.e.journal == nil {
+		return errors.Trace(err)
+	}
+	for _, entry := range t.entries {
+		if jerr := t.e.journal.Record(entry); jerr != nil {
+			return errors.Annotate(jerr, "record journal")
+		}
+	}
+	return nil
+}
+
+// Rollback rolls back the transaction, none of its statements are recorded.
+func (t *TxExecer) Rollback() error {
+	return errors.Trace(t.tx.Rollback())
+}
@@ -0,0 +1,66 @@
+//go:build cgo
+
+package workload_test
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/july2993/bitest/workload"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testJournalSuite{})
+
+type testJournalSuite struct{}
+
+func (s *testJournalSuite) TestJournal(c *C) {
+	db, err := sql.Open("sqlite3", filepath.Join(c.MkDir(), "test.db"))
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := workload.OpenJournal(path)
+	c.Assert(err, IsNil)
+
+	ctx := context.Background()
+	env := &workload.Env{Journal: journal}
+	e := env.Execer(db, 1, 2)
+	_, err = env.Execer(db, 0, workload.MainWorker).ExecContext(ctx, "create table t(id integer primary key, v int)")
+	c.Assert(err, IsNil)
+	_, err = e.ExecContext(ctx, "insert into t(v) values(?), (?)", 10, 20)
+	c.Assert(err, IsNil)
+	_, err = e.ExecContext(ctx, "insert into t2(v) values(?)", 30)
+	c.Assert(err, NotNil)
+	c.Assert(journal.Close(), IsNil)
+
+	file, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer file.Close()
+	var entries []workload.Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry workload.Entry
+		c.Assert(json.Unmarshal(scanner.Bytes(), &entry), IsNil)
+		entries = append(entries, entry)
+	}
+	c.Assert(entries, HasLen, 3)
+
+	c.Assert(entries[0].Worker, Equals, workload.MainWorker)
+	insert := entries[1]
+	c.Assert(insert.Cluster, Equals, 1)
+	c.Assert(insert.Worker, Equals, 2)
+	c.Assert(insert.SQL, Equals, "insert into t(v) values(?), (?)")
+	c.Assert(insert.Args, DeepEquals, []interface{}{float64(10), float64(20)})
+	c.Assert(insert.RowsAffected, Equals, int64(2))
+	c.Assert(insert.LastInsertID, Equals, int64(2))
+	c.Assert(insert.Err, Equals, "")
+	c.Assert(insert.End.Before(insert.Start), IsFalse)
+
+	c.Assert(entries[2].Err, Matches, ".*no such table.*")
+}
@@ -0,0 +1,340 @@
+package workload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+// DefaultKeyColumn is the unique key of the table of the workloads, the rows are identified by it when minimizing.
+const DefaultKeyColumn = "uk"
+
+// DefaultMaxTrials is the default max number of replays when minimizing.
+const DefaultMaxTrials = 500
+
+// DefaultTrialCheckTimeout is the default timeout of checking the databases converge after a trial replay.
+const DefaultTrialCheckTimeout = 5 * time.Second
+
+// MinimizeOptions is how to minimize a journal.
+type MinimizeOptions struct {
+	Replay ReplayOptions
+	// KeyColumn identifies the rows by the argument of the column in the statements, DefaultKeyColumn if empty.
+	KeyColumn string
+	// MaxTrials is the max number of replays, DefaultMaxTrials if 0.
+	MaxTrials int
+	// TrialCheckTimeout is the timeout of checking the databases converge at the checks of the entries and after each
+	// trial replay, DefaultTrialCheckTimeout if 0. Most trials diverge and wait the whole timeout, so it's much shorter
+	// than the timeout of env.Check, which is used for the first replay of all the entries only.
+	TrialCheckTimeout time.Duration
+}
+
+// Minimize shrinks the statements of entries while the databases still diverge after replaying them, like
+// Replay does. It removes the workers first, then the rows identified by the key column, then the single
+// statements. The statements not run by a worker, like creating the table and the DDL, and the checks
+// are always kept, so the journal should start from creating the tables like the workloads do.
+// The databases are not reset between the replays, the journal does it.
+// It only shrinks the recorded statements, it doesn't run the workload again by the seed with a smaller scale.
+func Minimize(ctx context.Context, env *Env, entries []Entry, opts MinimizeOptions) ([]Entry, error) {
+	entries, mode, err := opts.Replay.prepare(env, entries)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(opts.KeyColumn) == 0 {
+		opts.KeyColumn = DefaultKeyColumn
+	}
+	if opts.MaxTrials == 0 {
+		opts.MaxTrials = DefaultMaxTrials
+	}
+	if opts.TrialCheckTimeout == 0 {
+		opts.TrialCheckTimeout = DefaultTrialCheckTimeout
+	}
+
+	dbs, err := openReplayClusters(ctx, env, entries)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer closeDBs(dbs...)
+
+	m := &minimizer{
+		r:       &replayer{env: env, dbs: dbs, quiet: true, check: env.Check},
+		mode:    mode,
+		entries: entries,
+		max:     opts.MaxTrials,
+	}
+	var candidates []int
+	for i, e := range entries {
+		if e.Worker == MainWorker {
+			m.fixed = append(m.fixed, i)
+		} else {
+			candidates = append(candidates, i)
+		}
+	}
+
+	diverged, err := m.test(ctx, candidates)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !diverged {
+		return nil, errors.New("the databases converge after replaying the journal, nothing to minimize")
+	}
+	// the checks of the entries in the trial replays wait the short timeout too
+	m.r.check.Timeout = opts.TrialCheckTimeout
+
+	phases := []struct {
+		what string
+		key  func(e *Entry) (string, bool)
+	}{
+		{"workers", func(e *Entry) (string, bool) { return fmt.Sprintf("%d-%d-%d", e.Round, e.Cluster, e.Worker), true }},
+		{"rows", func(e *Entry) (string, bool) { return rowKey(e, opts.KeyColumn) }},
+		{"statements", func(e *Entry) (string, bool) { return "", false }},
+	}
+	for {
+		before := len(candidates)
+		for _, phase := range phases {
+			units, kept := groupBy(entries, candidates, phase.key)
+			candidates, err = m.reduce(ctx, phase.what, units, kept)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		if len(candidates) == before || m.trials >= m.max {
+			break
+		}
+	}
+
+	minimized := m.merge(candidates)
+	log.Info("minimize finished", zap.Int("statements", len(candidates)),
+		zap.Int("entries", len(minimized)),
+		zap.Int("original-entries", len(entries)),
+		zap.Int("trials", m.trials))
+	return minimized, nil
+}
+
+type minimizer struct {
+	r       *replayer
+	mode    ReplayMode
+	entries []Entry
+	// fixed are the index of the entries always kept
+	fixed []int
+
+	trials int
+	max    int
+}
+
+// merge returns the fixed entries and the entries of candidates in the original order.
+func (m *minimizer) merge(candidates []int) []Entry {
+	idxs := append(append([]int(nil), m.fixed...), candidates...)
+	sort.Ints(idxs)
+	merged := make([]Entry, 0, len(idxs))
+	for _, i := range idxs {
+		merged = append(merged, m.entries[i])
+	}
+	return merged
+}
+
+// test replays the fixed entries and candidates and returns whether the databases diverge.
+func (m *minimizer) test(ctx context.Context, candidates []int) (bool, error) {
+	m.trials++
+	start := time.Now()
+	err := m.r.replay(ctx, m.merge(candidates), m.mode)
+	if err == nil {
+		err = CheckConverge(ctx, m.r.dbs, m.r.env.layout(), m.r.check)
+	}
+	diverged := errors.Cause(err) == ErrNotEqual
+	if err != nil && !diverged {
+		return false, errors.Trace(err)
+	}
+
+	log.Info("minimize trial", zap.Int("trial", m.trials),
+		zap.Int("statements", len(candidates)),
+		zap.Bool("diverged", diverged),
+		zap.Duration("duration", time.Since(start)))
+	return diverged, nil
+}
+
+// reduce removes the units of candidates by delta debugging while the databases still diverge, the candidates
+// not in any unit are kept.
+func (m *minimizer) reduce(ctx context.Context, what string, units [][]int, kept []int) ([]int, error) {
+	join := func(units [][]int) []int {
+		candidates := append([]int(nil), kept...)
+		for _, unit := range units {
+			candidates = append(candidates, unit...)
+		}
+		return candidates
+	}
+
+	n := 2
+	for len(units) >= 2 && m.trials < m.max {
+		chunk := int(math.Ceil(float64(len(units)) / float64(n)))
+		reduced := false
+		for start := 0; start < len(units) && m.trials < m.max; start += chunk {
+			end := start + chunk
+			if end > len(units) {
+				end = len(units)
+			}
+			complement := append(append([][]int(nil), units[:start]...), units[end:]...)
+			diverged, err := m.test(ctx, join(complement))
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if diverged {
+				units = complement
+				if n > 2 {
+					n--
+				}
+				reduced = true
+				break
+			}
+		}
+		if !reduced {
+			if n >= len(units) {
+				break
+			}
+			n *= 2
+			if n > len(units) {
+				n = len(units)
+			}
+		}
+	}
+
+	log.Info("minimize reduced", zap.String("by", what), zap.Int("units", len(units)))
+	return join(units), nil
+}
+
+// groupBy groups the candidates into units by key, the ones without key are a unit each if all the candidates
+// don't have a key, or else they're not in any unit and returned as kept.
+func groupBy(entries []Entry, candidates []int, key func(e *Entry) (string, bool)) ([][]int, []int) {
+	var units [][]int
+	var kept []int
+	unitOf := make(map[string]int)
+	for _, i := range candidates {
+		k, ok := key(&entries[i])
+		if !ok {
+			kept = append(kept, i)
+			continue
+		}
+		u, ok := unitOf[k]
+		if !ok {
+			u = len(units)
+			unitOf[k] = u
+			units = append(units, nil)
+		}
+		units[u] = append(units[u], i)
+	}
+
+	if len(units) == 0 {
+		for _, i := range kept {
+			units = append(units, []int{i})
+		}
+		kept = nil
+	}
+	return units, kept
+}
+
+var (
+	insertColumnsRe = regexp.MustCompile(`(?i)\(([^()]*)\)\s*values\s*\(`)
+	placeholderRe   = regexp.MustCompile(`\?`)
+)
+
+// rowKey returns the argument of column in the statement of e, like the uk of
+// "replace into auto1(uk, v) values(?, ?)" or "delete from auto1 where uk = ?".
+func rowKey(e *Entry, column string) (string, bool) {
+	if strings.Count(e.SQL, "?") != len(e.Args) {
+		return "", false
+	}
+
+	if m := insertColumnsRe.FindStringSubmatchIndex(e.SQL); m != nil {
+		before := strings.Count(e.SQL[:m[1]], "?")
+		for i, col := range strings.Split(e.SQL[m[2]:m[3]], ",") {
+			if strings.EqualFold(strings.Trim(col, " `"), column) {
+				return fmt.Sprint(e.Args[before+i]), true
+			}
+		}
+		return "", false
+	}
+
+	re, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(column) + "`?\\s*=\\s*\\?")
+	if err != nil {
+		return "", false
+	}
+	loc := re.FindStringIndex(e.SQL)
+	if loc == nil {
+		return "", false
+	}
+	return fmt.Sprint(e.Args[strings.Count(e.SQL[:loc[1]], "?")-1]), true
+}
+
+// WriteSQL writes the statements of entries as a SQL script with the arguments interpolated, a comment
+// before each statement tells the database to run it on, and the checks are comments too.
+func WriteSQL(w io.Writer, entries []Entry) error {
+	statements := 0
+	for _, e := range entries {
+		if !e.Check {
+			statements++
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- %d statements, run each one on the database of the comment in order\n", statements)
+	for _, e := range entries {
+		if e.Check {
+			fmt.Fprintf(bw, "-- wait for the databases to converge\n")
+			continue
+		}
+
+		worker := "main"
+		if e.Worker != MainWorker {
+			worker = strconv.Itoa(e.Worker)
+		}
+		stmt := strings.TrimRight(strings.TrimSpace(interpolate(e.SQL, e.Args)), ";")
+		fmt.Fprintf(bw, "-- db%d worker %s", e.Cluster+1, worker)
+		if len(e.Err) > 0 {
+			fmt.Fprintf(bw, " error: %s", strings.Replace(e.Err, "\n", " ", -1))
+		}
+		fmt.Fprintf(bw, "\n%s;\n", stmt)
+	}
+	return errors.Trace(bw.Flush())
+}
+
+// interpolate replaces the placeholders of query by the literal of args.
+func interpolate(query string, args []interface{}) string {
+	i := 0
+	return placeholderRe.ReplaceAllStringFunc(query, func(s string) string {
+		if i >= len(args) {
+			return s
+		}
+		arg := args[i]
+		i++
+		switch v := arg.(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return quote(v)
+		case []byte:
+			return quote(string(v))
+		case bool:
+			if v {
+				return "1"
+			}
+			return "0"
+		case time.Time:
+			return quote(v.Format("2006-01-02 15:04:05.999999"))
+		default:
+			return fmt.Sprint(v)
+		}
+	})
+}
+
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,135 @@
+package workload_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testMinimizeSuite{})
+
+type testMinimizeSuite struct{}
+
+func (s *testMinimizeSuite) TestMinimize(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	var entries []workload.Entry
+	at := time.Now()
+	add := func(cluster, worker int, sql string, args ...interface{}) {
+		at = at.Add(time.Millisecond)
+		entries = append(entries, workload.Entry{Cluster: cluster, Worker: worker, Start: at, End: at.Add(time.Microsecond),
+			SQL: sql, Args: args})
+	}
+	for cluster := 0; cluster < 2; cluster++ {
+		add(cluster, workload.MainWorker, "drop table if exists auto1")
+		add(cluster, workload.MainWorker, "create table auto1(uk bigint primary key, v bigint)")
+	}
+	at = at.Add(time.Millisecond)
+	entries = append(entries, workload.Entry{Worker: workload.MainWorker, Start: at, End: at, Check: true})
+	// the same rows are written to both of the databases, but uk 8 is only updated in db2
+	for uk := int64(1); uk <= 10; uk++ {
+		for cluster := 0; cluster < 2; cluster++ {
+			add(cluster, int(uk%3), "replace into auto1(uk, v) values(?, ?)", uk, uk)
+		}
+	}
+	add(1, 0, "update auto1 set v = ? where uk = ?", int64(80), int64(8))
+	for uk := int64(1); uk <= 10; uk += 2 {
+		for cluster := 0; cluster < 2; cluster++ {
+			add(cluster, 1, "delete from auto1 where uk = ?", uk)
+		}
+	}
+
+	// only the first replay waits the timeout of env for the databases to converge
+	env := &workload.Env{DSNs: dsns, Session: true, Check: workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond}}
+	opts := workload.MinimizeOptions{Replay: workload.ReplayOptions{Mode: workload.ReplaySerial}, TrialCheckTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	minimized, err := workload.Minimize(context.Background(), env, entries, opts)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) < 4*time.Second, IsTrue, Commentf("duration %s", time.Since(start)))
+	// any single statement of a row diverges as there's no replication between the databases
+	c.Assert(minimized, HasLen, 6)
+	c.Assert(minimized[:5], DeepEquals, entries[:5])
+	c.Assert(minimized[5].Worker, Not(Equals), workload.MainWorker)
+
+	// the journal converges without the update of uk 8
+	var converged []workload.Entry
+	for _, e := range entries {
+		if !strings.HasPrefix(e.SQL, "update") {
+			converged = append(converged, e)
+		}
+	}
+	_, err = workload.Minimize(context.Background(), env, converged, opts)
+	c.Assert(err, ErrorMatches, ".*nothing to minimize")
+}
+
+func (s *testMinimizeSuite) TestMinimizeCheck(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	var entries []workload.Entry
+	at := time.Now()
+	add := func(cluster, worker int, sql string, args ...interface{}) {
+		at = at.Add(time.Millisecond)
+		entries = append(entries, workload.Entry{Cluster: cluster, Worker: worker, Start: at, End: at.Add(time.Microsecond),
+			SQL: sql, Args: args})
+	}
+	check := func() {
+		at = at.Add(time.Millisecond)
+		entries = append(entries, workload.Entry{Worker: workload.MainWorker, Start: at, End: at, Check: true})
+	}
+	for cluster := 0; cluster < 2; cluster++ {
+		add(cluster, workload.MainWorker, "drop table if exists auto1")
+		add(cluster, workload.MainWorker, "create table auto1(uk bigint primary key, v bigint)")
+	}
+	check()
+	for uk := int64(1); uk <= 10; uk++ {
+		for cluster := 0; cluster < 2; cluster++ {
+			add(cluster, int(uk%3), "replace into auto1(uk, v) values(?, ?)", uk, uk)
+		}
+	}
+	add(1, 0, "update auto1 set v = ? where uk = ?", int64(80), int64(8))
+	// the trials diverged before the check in the middle stop at it in the trial timeout
+	check()
+	for uk := int64(11); uk <= 14; uk++ {
+		for cluster := 0; cluster < 2; cluster++ {
+			add(cluster, 1, "replace into auto1(uk, v) values(?, ?)", uk, uk)
+		}
+	}
+
+	env := &workload.Env{DSNs: dsns, Session: true, Check: workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond}}
+	opts := workload.MinimizeOptions{Replay: workload.ReplayOptions{Mode: workload.ReplaySerial}, TrialCheckTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	minimized, err := workload.Minimize(context.Background(), env, entries, opts)
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) < 4*time.Second, IsTrue, Commentf("duration %s", time.Since(start)))
+	c.Assert(minimized, HasLen, 7)
+	c.Assert(minimized[:5], DeepEquals, entries[:5])
+	c.Assert(minimized[6].Check, IsTrue)
+}
+
+func (s *testMinimizeSuite) TestWriteSQL(c *C) {
+	entries := []workload.Entry{
+		{Worker: workload.MainWorker, SQL: "create table t(id bigint primary key, s varchar(10));"},
+		{Worker: workload.MainWorker, Check: true},
+		{Cluster: 1, Worker: 2, SQL: "replace into t(id, s) values(?, ?)", Args: []interface{}{int64(1), "it's"}},
+		{Cluster: 0, Worker: 3, SQL: "update t set s = ? where id = ?", Args: []interface{}{nil, 1.5}, Err: "Error 1105:\nfail"},
+	}
+	var buf bytes.Buffer
+	c.Assert(workload.WriteSQL(&buf, entries), IsNil)
+	c.Assert(buf.String(), Equals, `-- 3 statements, run each one on the database of the comment in order
+-- db1 worker main
+create table t(id bigint primary key, s varchar(10));
+-- wait for the databases to converge
+-- db2 worker 2
+replace into t(id, s) values(1, 'it\'s');
+-- db1 worker 3 error: Error 1105: fail
+update t set s = NULL where id = 1.5;
+`)
+}
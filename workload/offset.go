@@ -0,0 +1,149 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// OffsetOptions is the options of Offset.
+type OffsetOptions struct {
+	// N is how many rows to fill the table, 0 means DefaultOffsetRows.
+	N int64
+	// Increment is the value of auto_increment_increment, 0 means DefaultIncrement.
+	Increment int
+	// Offset is the value of auto_increment_offset, 0 means DefaultOffset.
+	Offset int
+}
+
+// The defaults of OffsetOptions.
+const (
+	DefaultOffsetRows = 10000
+	DefaultIncrement  = 2
+	DefaultOffset     = 1
+)
+
+func (o OffsetOptions) withDefault() OffsetOptions {
+	if o.N == 0 {
+		o.N = DefaultOffsetRows
+	}
+	if o.Increment == 0 {
+		o.Increment = DefaultIncrement
+	}
+	if o.Offset == 0 {
+		o.Offset = DefaultOffset
+	}
+	return o
+}
+
+// Offset validates the correctness of auto_increment_increment & auto_increment_offset.
+type Offset struct {
+	opts OffsetOptions
+
+	db *sql.DB
+}
+
+var _ Workload = &Offset{}
+
+// NewOffset returns an Offset workload.
+func NewOffset(opts OffsetOptions) *Offset {
+	return &Offset{opts: opts.withDefault()}
+}
+
+func (w *Offset) Name() string { return "offset" }
+
+func (w *Offset) Short() string {
+	return "validate the correctness of auto_increment_increment & auto_increment_offset"
+}
+
+func (w *Offset) Long() string {
+	return `
+validate the correctness of auto_increment_increment & auto_increment_offset by:
+1, create a table:
+	create table auto1(id bigint primary key auto_increment, uk bigint unique key, v bigint);
+
+2, insert n rows with specified increment and offset setted while global or session, then validate the
+auto generated column id.
+
+3, check the return value of the flowing query must equal n.
+	("select count(*) from auto1 where (id - %d) %% %d = 0", offset, increment)
+	`
+}
+
+func (w *Offset) Clusters() int { return 1 }
+
+func (w *Offset) Flags(fs *pflag.FlagSet) {
+	fs.Int64Var(&w.opts.N, "n", DefaultOffsetRows, "how many rows to fill the table")
+	fs.IntVar(&w.opts.Offset, "offset", DefaultOffset, "the value of auto_increment_offset")
+	fs.IntVar(&w.opts.Increment, "increment", DefaultIncrement, "the value of auto_increment_increment")
+}
+
+func (w *Offset) validateOptions(env *Env) error {
+	if w.opts.N <= 0 {
+		return errors.Errorf("n must be positive, but got %d", w.opts.N)
+	}
+	if w.opts.Increment <= 0 || w.opts.Offset <= 0 {
+		return errors.Errorf("increment %d and offset %d must be positive", w.opts.Increment, w.opts.Offset)
+	}
+	return nil
+}
+
+func (w *Offset) Prepare(ctx context.Context, env *Env) error {
+	log.Info("config", zap.Int("increment", w.opts.Increment), zap.Int("offset", w.opts.Offset))
+
+	dsn := env.DSNs[0]
+	if env.Session {
+		dsn = SessionDSN(dsn, w.opts.Increment, w.opts.Offset)
+	} else {
+		err := SetGlobalVar(ctx, dsn, w.opts.Increment, w.opts.Offset)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("set global var success")
+	}
+
+	var err error
+	w.db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(setupAutoIncrementAndOffset(ctx, env.Execer(w.db, 0, MainWorker)))
+}
+
+func (w *Offset) Run(ctx context.Context, env *Env) error {
+	return errors.Trace(loadAutoIncrementAndOffset(ctx, env, w.db, 0, w.opts.N))
+}
+
+func (w *Offset) Verify(ctx context.Context, env *Env) error {
+	// check auto increment value
+	qstr := fmt.Sprintf("select count(*) from auto1 where (id - %d) %% %d = 0", w.opts.Offset, w.opts.Increment)
+	row := w.db.QueryRowContext(ctx, qstr)
+	var getn int64
+	err := row.Scan(&getn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if getn != w.opts.N {
+		return errors.Errorf("fail check, expect: %d, but: %d, sql: %s", w.opts.N, getn, qstr)
+	}
+	return nil
+}
+
+func (w *Offset) Cleanup(ctx context.Context, env *Env) error {
+	if w.db == nil {
+		return nil
+	}
+	defer func() {
+		w.db.Close()
+		w.db = nil
+	}()
+
+	return errors.Trace(cleanupAutoIncrementAndOffset(ctx, env.Execer(w.db, 0, MainWorker)))
+}
@@ -0,0 +1,38 @@
+package workload
+
+import (
+	"math/rand"
+	"time"
+)
+
+// NewSeed returns a seed from the current time, for the runs without a seed.
+func NewSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// mixSeed derives a seed from seed and id by splitmix64, so the nearby ids get unrelated seeds.
+func mixSeed(seed int64, id int64) int64 {
+	z := uint64(seed) + uint64(id+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// roundSeed returns the seed of the round, the first round uses seed itself so a failed round can be
+// run again by its seed.
+func roundSeed(seed int64, round int) int64 {
+	if round == 1 {
+		return seed
+	}
+	return mixSeed(seed, int64(round))
+}
+
+// Rand returns the random source of the worker identified by ids, like the index of the database and
+// the worker of it. The same seed and ids always get the same sequence, it's not safe for concurrent use.
+func (env *Env) Rand(ids ...int) *rand.Rand {
+	seed := env.Seed
+	for _, id := range ids {
+		seed = mixSeed(seed, int64(id))
+	}
+	return rand.New(rand.NewSource(seed))
+}
@@ -0,0 +1,308 @@
+package workload
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReplayMode is how to order the statements when replaying a journal.
+type ReplayMode string
+
+// The modes of replaying.
+const (
+	// ReplayWorker runs the workers concurrently, each worker runs its statements in order, and a statement
+	// starts after all the statements ended before it started in the journal.
+	ReplayWorker ReplayMode = "worker"
+	// ReplaySerial runs the statements one by one in the order they started.
+	ReplaySerial ReplayMode = "serial"
+)
+
+// ReplayOptions is how to replay a journal.
+type ReplayOptions struct {
+	// Mode is ReplayWorker if empty.
+	Mode ReplayMode
+	// Round replays the entries of the round only if not 0.
+	Round int
+}
+
+// ReadJournal reads the entries of the journal file. The numbers of the arguments are read as int64
+// if possible, or else float64.
+func ReadJournal(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	dec := json.NewDecoder(bufio.NewReader(file))
+	dec.UseNumber()
+	for dec.More() {
+		var e Entry
+		err = dec.Decode(&e)
+		if err != nil {
+			return nil, errors.Annotatef(err, "read journal %s entry %d", path, len(entries)+1)
+		}
+		for i, arg := range e.Args {
+			if num, ok := arg.(json.Number); ok {
+				e.Args[i], err = num.Int64()
+				if err != nil {
+					e.Args[i], err = num.Float64()
+				}
+				if err != nil {
+					return nil, errors.Annotatef(err, "read journal %s entry %d", path, len(entries)+1)
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Replay runs the statements of entries on the databases of env, with the same auto_increment_increment
+// and auto_increment_offset as the workloads, waits for the databases to converge at the checks of the
+// workload, then checks all the databases converge at last. The statements can get another result
+// than the journal, like a different number of affected rows, they're logged and counted.
+func Replay(ctx context.Context, env *Env, entries []Entry, opts ReplayOptions) error {
+	entries, mode, err := opts.prepare(env, entries)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("replay", zap.Int("entries", len(entries)),
+		zap.String("mode", string(mode)),
+		zap.Int("round", opts.Round),
+		zap.Strings("dsns", redactDSNs(env.DSNs)))
+
+	dbs, err := openReplayClusters(ctx, env, entries)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer closeDBs(dbs...)
+
+	r := &replayer{env: env, dbs: dbs, check: env.Check}
+	err = r.replay(ctx, entries, mode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	log.Info("replay finished", zap.Int("entries", len(entries)), zap.Int64("mismatches", r.mismatches))
+	return errors.Trace(CheckConverge(ctx, dbs, env.layout(), env.Check))
+}
+
+// prepare returns the entries of the round and the mode to replay, and checks env can replay them.
+func (opts ReplayOptions) prepare(env *Env, entries []Entry) ([]Entry, ReplayMode, error) {
+	if opts.Round != 0 {
+		var round []Entry
+		for _, e := range entries {
+			if e.Round == opts.Round {
+				round = append(round, e)
+			}
+		}
+		entries = round
+	}
+	mode := opts.Mode
+	if len(mode) == 0 {
+		mode = ReplayWorker
+	}
+	if mode != ReplayWorker && mode != ReplaySerial {
+		return nil, "", errors.Errorf("unknown replay mode %s", mode)
+	}
+
+	clusters := 1
+	for _, e := range entries {
+		if e.Cluster >= clusters {
+			clusters = e.Cluster + 1
+		}
+	}
+	if len(env.DSNs) < clusters {
+		return nil, "", errors.Errorf("the journal needs %d databases, but got %d", clusters, len(env.DSNs))
+	}
+	return entries, mode, errors.Trace(env.layout().Validate())
+}
+
+// openReplayClusters opens the databases of env with enough connections for the workers of entries.
+func openReplayClusters(ctx context.Context, env *Env, entries []Entry) ([]*sql.DB, error) {
+	workers := 0
+	for _, e := range entries {
+		if e.Worker >= workers {
+			workers = e.Worker + 1
+		}
+	}
+	// the main worker and all the workers may run concurrently
+	dbs, err := OpenClusters(ctx, env.DSNs, workers+1, env.Session)
+	return dbs, errors.Trace(err)
+}
+
+type replayer struct {
+	env *Env
+	dbs []*sql.DB
+	// quiet logs the mismatches at debug level
+	quiet bool
+	// check is how to check the databases converge at the checks of the entries
+	check CheckOptions
+
+	mu         sync.Mutex
+	mismatches int64
+}
+
+// run runs the statement of e, or waits for the databases to converge if e is a check.
+func (r *replayer) run(ctx context.Context, e *Entry) error {
+	if e.Check {
+		return errors.Trace(CheckConverge(ctx, r.dbs, r.env.layout(), r.check))
+	}
+
+	res, err := r.dbs[e.Cluster].ExecContext(ctx, e.SQL, e.Args...)
+	var affected int64
+	if err == nil {
+		affected, _ = res.RowsAffected()
+	}
+	if (err != nil) != (len(e.Err) > 0) || (err == nil && affected != e.RowsAffected) {
+		r.mu.Lock()
+		r.mismatches++
+		r.mu.Unlock()
+		logf := log.Warn
+		if r.quiet {
+			logf = log.Debug
+		}
+		logf("replay result mismatch", zap.Int("cluster", e.Cluster),
+			zap.Int("worker", e.Worker),
+			zap.String("sql", e.SQL),
+			zap.Reflect("args", e.Args),
+			zap.Int64("rows-affected", affected),
+			zap.Int64("journal-rows-affected", e.RowsAffected),
+			zap.Error(err),
+			zap.String("journal-error", e.Err))
+	}
+	return nil
+}
+
+// replay runs entries by mode.
+func (r *replayer) replay(ctx context.Context, entries []Entry, mode ReplayMode) error {
+	if mode == ReplaySerial {
+		return errors.Trace(r.replaySerial(ctx, entries))
+	}
+	return errors.Trace(r.replayWorkers(ctx, entries))
+}
+
+func (r *replayer) replaySerial(ctx context.Context, entries []Entry) error {
+	sorted := make([]*Entry, 0, len(entries))
+	for i := range entries {
+		sorted = append(sorted, &entries[i])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	for _, e := range sorted {
+		if err := r.run(ctx, e); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (r *replayer) replayWorkers(ctx context.Context, entries []Entry) error {
+	// byEnd is the entries in the order they ended, an entry waits until all the entries ended before
+	// it started are done, which includes the previous one of the same worker.
+	byEnd := make([]int, len(entries))
+	for i := range byEnd {
+		byEnd[i] = i
+	}
+	sort.SliceStable(byEnd, func(i, j int) bool { return entries[byEnd[i]].End.Before(entries[byEnd[j]].End) })
+	endRank := make([]int, len(entries))
+	for rank, i := range byEnd {
+		endRank[i] = rank
+	}
+
+	s := newReplaySchedule(len(entries))
+	type workerID struct{ round, cluster, worker int }
+	var order []workerID
+	workers := make(map[workerID][]int)
+	for i, e := range entries {
+		id := workerID{e.Round, e.Cluster, e.Worker}
+		if _, ok := workers[id]; !ok {
+			order = append(order, id)
+		}
+		workers[id] = append(workers[id], i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, id := range order {
+		idxs := workers[id]
+		eg.Go(func() error {
+			for _, i := range idxs {
+				e := &entries[i]
+				// the number of the entries ended before e started
+				before := sort.Search(len(byEnd), func(k int) bool { return !entries[byEnd[k]].End.Before(e.Start) })
+				if err := s.wait(ctx, before); err != nil {
+					return errors.Trace(err)
+				}
+				if err := r.run(ctx, e); err != nil {
+					return errors.Trace(err)
+				}
+				s.done(endRank[i])
+			}
+			return nil
+		})
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.broadcast()
+	}()
+	return errors.Trace(eg.Wait())
+}
+
+// replaySchedule tracks how many entries in the order of end are all done.
+type replaySchedule struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	finished []bool
+	prefix   int
+}
+
+func newReplaySchedule(n int) *replaySchedule {
+	s := &replaySchedule{finished: make([]bool, n)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// wait waits until the first n entries in the order of end are done.
+func (s *replaySchedule) wait(ctx context.Context, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.prefix < n {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.cond.Wait()
+	}
+	return nil
+}
+
+// done marks the entry of rank in the order of end done.
+func (s *replaySchedule) done(rank int) {
+	s.mu.Lock()
+	s.finished[rank] = true
+	for s.prefix < len(s.finished) && s.finished[s.prefix] {
+		s.prefix++
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *replaySchedule) broadcast() {
+	s.mu.Lock()
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
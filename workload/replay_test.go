@@ -0,0 +1,96 @@
+package workload_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Suite(&testReplaySuite{})
+
+type testReplaySuite struct{}
+
+// startServer starts an in-process MySQL compatible server with the databases db1 and db2,
+// it returns the server, the connection without database and the dsn of the databases.
+func startServer(c *C) (*server.Server, *sql.DB, []string) {
+	return startServerWith(c, "db1", "db2")
+}
+
+// startServerWith starts the server like startServer with the databases of names.
+func startServerWith(c *C, names ...string) (*server.Server, *sql.DB, []string) {
+	logrus.SetLevel(logrus.ErrorLevel)
+	provider := memory.NewDBProviderWithOpts(memory.NativeIndexProvider(true)).(*memory.DbProvider)
+	engine := sqle.NewDefault(provider)
+	cfg := server.Config{Protocol: "tcp", Address: "127.0.0.1:0"}
+	s, err := server.NewServer(cfg, engine, gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	c.Assert(err, IsNil)
+	go s.Start()
+
+	addr := s.Listener.Addr().String()
+	admin, err := sql.Open("mysql", fmt.Sprintf("root@tcp(%s)/", addr))
+	c.Assert(err, IsNil)
+	var dsns []string
+	for _, name := range names {
+		_, err = admin.Exec("create database " + name)
+		c.Assert(err, IsNil)
+		dsns = append(dsns, fmt.Sprintf("root@tcp(%s)/%s?interpolateParams=true", addr, name))
+	}
+	return s, admin, dsns
+}
+
+func (s *testReplaySuite) TestReplay(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := workload.OpenJournal(path)
+	c.Assert(err, IsNil)
+	at := time.Now()
+	record := func(cluster, worker int, affected int64, sql string, args ...interface{}) {
+		at = at.Add(time.Millisecond)
+		e := &workload.Entry{Round: 1, Cluster: cluster, Worker: worker, Start: at, End: at.Add(time.Microsecond),
+			SQL: sql, Args: args, RowsAffected: affected}
+		c.Assert(journal.Record(e), IsNil)
+	}
+	for cluster := 0; cluster < 2; cluster++ {
+		record(cluster, workload.MainWorker, 0, "create table t(id bigint primary key, v bigint)")
+	}
+	at = at.Add(time.Millisecond)
+	c.Assert(journal.Record(&workload.Entry{Round: 1, Worker: workload.MainWorker, Start: at, End: at, Check: true}), IsNil)
+	// each row is inserted into both of the databases by different workers
+	for i := 0; i < 20; i++ {
+		record(i%2, i%3, 1, "insert into t values(?, ?)", int64(1)<<60+int64(i/2), i/2)
+	}
+	// the journal of another round is ignored
+	c.Assert(journal.Record(&workload.Entry{Round: 2, SQL: "insert into t values(1, 1)", Start: at, End: at}), IsNil)
+	c.Assert(journal.Close(), IsNil)
+
+	entries, err := workload.ReadJournal(path)
+	c.Assert(err, IsNil)
+	c.Assert(entries, HasLen, 24)
+	c.Assert(entries[3].Args, DeepEquals, []interface{}{int64(1) << 60, int64(0)})
+
+	env := &workload.Env{DSNs: dsns, Session: true, Check: workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond}}
+	for _, mode := range []workload.ReplayMode{workload.ReplayWorker, workload.ReplaySerial} {
+		for _, name := range []string{"db1", "db2"} {
+			_, err = admin.Exec(fmt.Sprintf("drop table if exists %s.t", name))
+			c.Assert(err, IsNil)
+		}
+		err = workload.Replay(context.Background(), env, entries, workload.ReplayOptions{Mode: mode, Round: 1})
+		c.Assert(err, IsNil, Commentf("mode %s", mode))
+	}
+
+	err = workload.Replay(context.Background(), env, entries, workload.ReplayOptions{Mode: "random"})
+	c.Assert(err, ErrorMatches, "unknown replay mode random")
+}
@@ -0,0 +1,327 @@
+package workload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// The replication roles of a cluster.
+const (
+	// RolePrimary is where the workloads run the DDL, it's db1 of the workloads.
+	RolePrimary = "primary"
+	// RoleSecondary receives the DDL from the primary by replication.
+	RoleSecondary = "secondary"
+)
+
+// DefaultDatabase is the default schema used by the workloads.
+const DefaultDatabase = "test"
+
+// defaultParams are the DSN parameters used unless overridden by DBConfig.Params, in order.
+var defaultParams = [][2]string{
+	{"interpolateParams", "true"},
+	{"readTimeout", "1m"},
+	{"multiStatements", "true"},
+}
+
+// TLSConfig is how to connect a database by TLS.
+type TLSConfig struct {
+	// CA is the path of the CA certificate to verify the server, the system CAs are used if empty.
+	CA string `toml:"ca" yaml:"ca"`
+	// Cert and Key are the path of the client certificate and key.
+	Cert       string `toml:"cert" yaml:"cert"`
+	Key        string `toml:"key" yaml:"key"`
+	ServerName string `toml:"server-name" yaml:"server-name"`
+	SkipVerify bool   `toml:"skip-verify" yaml:"skip-verify"`
+}
+
+// DBConfig is how to connect a MySQL or TiDB database.
+type DBConfig struct {
+	// Name is the name of the cluster in the topology.
+	Name string `toml:"name" yaml:"name"`
+	// Role is the replication role of the cluster, RolePrimary or RoleSecondary.
+	Role string `toml:"role" yaml:"role"`
+
+	User     string `toml:"user" yaml:"user"`
+	Password string `toml:"password" yaml:"password"`
+	Host     string `toml:"host" yaml:"host"`
+	Port     int    `toml:"port" yaml:"port"`
+	// Socket is the path of the unix socket, Host and Port are ignored if it's set.
+	Socket string `toml:"socket" yaml:"socket"`
+	// Database is the default schema, DefaultDatabase if empty.
+	Database string `toml:"database" yaml:"database"`
+	// Params are the DSN parameters of github.com/go-sql-driver/mysql, they override the defaults.
+	Params map[string]string `toml:"params" yaml:"params"`
+	TLS    *TLSConfig        `toml:"tls" yaml:"tls"`
+}
+
+// DSN returns the dsn of the database, RegisterTLS must be called before using the dsn if TLS is set.
+func (c DBConfig) DSN() string {
+	addr := fmt.Sprintf("tcp(%s:%d)", c.Host, c.Port)
+	if len(c.Socket) > 0 {
+		addr = fmt.Sprintf("unix(%s)", c.Socket)
+	}
+	database := c.Database
+	if len(database) == 0 {
+		database = DefaultDatabase
+	}
+
+	var params []string
+	for _, kv := range defaultParams {
+		v, ok := c.Params[kv[0]]
+		if !ok {
+			v = kv[1]
+		}
+		params = append(params, kv[0]+"="+url.QueryEscape(v))
+	}
+	var extra []string
+	for k, v := range c.Params {
+		if !isDefaultParam(k) {
+			extra = append(extra, k+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(extra)
+	params = append(params, extra...)
+	if c.TLS != nil {
+		params = append(params, "tls="+c.tlsName())
+	}
+
+	return fmt.Sprintf("%s:%s@%s/%s?%s", c.User, c.Password, addr, database, strings.Join(params, "&"))
+}
+
+// RedactDSN hides the password of dsn for logging.
+func RedactDSN(dsn string) string {
+	// split the dsn the same way as the mysql driver: the last '@' before the last '/'
+	slash := strings.LastIndex(dsn, "/")
+	if slash < 0 {
+		return dsn
+	}
+	at := strings.LastIndex(dsn[:slash], "@")
+	if at < 0 {
+		return dsn
+	}
+	colon := strings.Index(dsn[:at], ":")
+	if colon < 0 || colon+1 == at {
+		return dsn
+	}
+	return dsn[:colon+1] + "***" + dsn[at:]
+}
+
+func isDefaultParam(key string) bool {
+	for _, kv := range defaultParams {
+		if kv[0] == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c DBConfig) tlsName() string {
+	return "bitest-" + c.Name
+}
+
+// RegisterTLS registers the TLS config to the mysql driver, it does nothing if TLS is not set.
+func (c DBConfig) RegisterTLS() error {
+	if c.TLS == nil {
+		return nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         c.TLS.ServerName,
+		InsecureSkipVerify: c.TLS.SkipVerify,
+	}
+	if len(cfg.ServerName) == 0 && len(c.Socket) == 0 {
+		cfg.ServerName = c.Host
+	}
+	if len(c.TLS.CA) > 0 {
+		pem, err := ioutil.ReadFile(c.TLS.CA)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificate found in %s", c.TLS.CA)
+		}
+	}
+	if len(c.TLS.Cert) > 0 || len(c.TLS.Key) > 0 {
+		cert, err := tls.LoadX509KeyPair(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return errors.Trace(mysql.RegisterTLSConfig(c.tlsName(), cfg))
+}
+
+// Topology is the clusters under test.
+type Topology struct {
+	// Layout is how the clusters replicate to each other, LayoutMesh if empty.
+	Layout   Layout     `toml:"layout" yaml:"layout"`
+	Clusters []DBConfig `toml:"clusters" yaml:"clusters"`
+}
+
+// LoadTopology loads the topology from a TOML file, or a YAML file if the extension is .yaml or .yml.
+// The user, password, host and port of a cluster can be overridden by the environment variables
+// BITEST_<NAME>_USER, BITEST_<NAME>_PASSWORD, BITEST_<NAME>_HOST and BITEST_<NAME>_PORT, where NAME is
+// the cluster name in upper case with the characters other than letters and digits replaced by '_'.
+// The TLS configs are registered to the mysql driver too.
+func LoadTopology(path string) (*Topology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	topo := new(Topology)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, topo)
+	default:
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), topo)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = errors.Errorf("unknown keys %v", meta.Undecoded())
+		}
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "parse topology %s", path)
+	}
+
+	err = topo.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	err = topo.validate()
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid topology %s", path)
+	}
+
+	for _, c := range topo.Clusters {
+		err = c.RegisterTLS()
+		if err != nil {
+			return nil, errors.Annotatef(err, "register tls of cluster %s", c.Name)
+		}
+	}
+	return topo, nil
+}
+
+// envPrefix returns the prefix of the environment variables overriding the cluster.
+func envPrefix(name string) string {
+	var b strings.Builder
+	b.WriteString("BITEST_")
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	b.WriteByte('_')
+	return b.String()
+}
+
+func (t *Topology) applyEnv(lookup func(string) (string, bool)) error {
+	for i := range t.Clusters {
+		c := &t.Clusters[i]
+		prefix := envPrefix(c.Name)
+		if v, ok := lookup(prefix + "USER"); ok {
+			c.User = v
+		}
+		if v, ok := lookup(prefix + "PASSWORD"); ok {
+			c.Password = v
+		}
+		if v, ok := lookup(prefix + "HOST"); ok {
+			c.Host = v
+		}
+		if v, ok := lookup(prefix + "PORT"); ok {
+			port, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.Annotatef(err, "invalid %sPORT", prefix)
+			}
+			c.Port = port
+		}
+	}
+	return nil
+}
+
+func (t *Topology) validate() error {
+	if len(t.Layout) > 0 {
+		if err := t.Layout.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	seen := make(map[string]struct{})
+	for _, c := range t.Clusters {
+		if len(c.Name) == 0 {
+			return errors.New("cluster without name")
+		}
+		if _, ok := seen[c.Name]; ok {
+			return errors.Errorf("duplicate cluster %s", c.Name)
+		}
+		seen[c.Name] = struct{}{}
+
+		switch c.Role {
+		case "", RolePrimary, RoleSecondary:
+		default:
+			return errors.Errorf("unknown role %s of cluster %s", c.Role, c.Name)
+		}
+		if len(c.Socket) == 0 && (len(c.Host) == 0 || c.Port == 0) {
+			return errors.Errorf("cluster %s needs host and port or socket", c.Name)
+		}
+	}
+	return nil
+}
+
+// Cluster returns the cluster of name.
+func (t *Topology) Cluster(name string) (DBConfig, error) {
+	for _, c := range t.Clusters {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return DBConfig{}, errors.NotFoundf("cluster %s", name)
+}
+
+// Select returns the clusters of names if names is not empty, or else all the clusters with the primary
+// ones first, then the others in the order of the topology. It fails if less than n clusters.
+func (t *Topology) Select(names []string, n int) ([]DBConfig, error) {
+	var clusters []DBConfig
+	if len(names) > 0 {
+		for _, name := range names {
+			c, err := t.Cluster(name)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			clusters = append(clusters, c)
+		}
+	} else {
+		for _, c := range t.Clusters {
+			if c.Role == RolePrimary {
+				clusters = append(clusters, c)
+			}
+		}
+		for _, c := range t.Clusters {
+			if c.Role != RolePrimary {
+				clusters = append(clusters, c)
+			}
+		}
+	}
+
+	if len(clusters) < n {
+		return nil, errors.Errorf("need %d clusters, but got %d", n, len(clusters))
+	}
+	return clusters, nil
+}
@@ -0,0 +1,113 @@
+package workload_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTopologySuite{})
+
+type testTopologySuite struct{}
+
+func (s *testTopologySuite) writeFile(c *C, name string, content string) string {
+	path := filepath.Join(c.MkDir(), name)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0644), IsNil)
+	return path
+}
+
+func (s *testTopologySuite) TestLoadTOML(c *C) {
+	path := s.writeFile(c, "topology.toml", `
+layout = "star"
+
+[[clusters]]
+name = "down-1"
+role = "secondary"
+socket = "/tmp/mysql.sock"
+user = "root"
+database = "bitest"
+[clusters.params]
+readTimeout = "10s"
+charset = "utf8mb4"
+
+[[clusters]]
+name = "up"
+role = "primary"
+host = "10.0.0.1"
+port = 4000
+user = "root"
+password = "in-file"
+[clusters.tls]
+skip-verify = true
+`)
+
+	os.Setenv("BITEST_DOWN_1_PASSWORD", "p@ss")
+	defer os.Unsetenv("BITEST_DOWN_1_PASSWORD")
+
+	topo, err := workload.LoadTopology(path)
+	c.Assert(err, IsNil)
+	c.Assert(topo.Clusters, HasLen, 2)
+	c.Assert(topo.Layout, Equals, workload.LayoutStar)
+
+	clusters, err := topo.Select(nil, 2)
+	c.Assert(err, IsNil)
+	c.Assert(clusters[0].Name, Equals, "up")
+	c.Assert(clusters[1].Name, Equals, "down-1")
+
+	c.Assert(clusters[0].DSN(), Equals,
+		"root:in-file@tcp(10.0.0.1:4000)/test?interpolateParams=true&readTimeout=1m&multiStatements=true&tls=bitest-up")
+	c.Assert(clusters[1].DSN(), Equals,
+		"root:p@ss@unix(/tmp/mysql.sock)/bitest?interpolateParams=true&readTimeout=10s&multiStatements=true&charset=utf8mb4")
+	c.Assert(workload.RedactDSN(clusters[1].DSN()), Equals,
+		"root:***@unix(/tmp/mysql.sock)/bitest?interpolateParams=true&readTimeout=10s&multiStatements=true&charset=utf8mb4")
+
+	clusters, err = topo.Select([]string{"down-1"}, 1)
+	c.Assert(err, IsNil)
+	c.Assert(clusters[0].Name, Equals, "down-1")
+
+	_, err = topo.Select([]string{"down-1"}, 2)
+	c.Assert(err, ErrorMatches, "need 2 clusters, but got 1")
+	_, err = topo.Select([]string{"not-exist"}, 1)
+	c.Assert(err, NotNil)
+}
+
+func (s *testTopologySuite) TestLoadYAML(c *C) {
+	path := s.writeFile(c, "topology.yaml", `
+clusters:
+  - name: a
+    host: 127.0.0.1
+    port: 4000
+    user: root
+  - name: b
+    host: 127.0.0.1
+    port: 5000
+    user: root
+`)
+	os.Setenv("BITEST_B_PORT", "5001")
+	defer os.Unsetenv("BITEST_B_PORT")
+
+	topo, err := workload.LoadTopology(path)
+	c.Assert(err, IsNil)
+	clusters, err := topo.Select(nil, 2)
+	c.Assert(err, IsNil)
+	c.Assert(clusters[0].Name, Equals, "a")
+	c.Assert(clusters[1].Port, Equals, 5001)
+}
+
+func (s *testTopologySuite) TestInvalid(c *C) {
+	cases := map[string]string{
+		"unknown.toml":   "[[clusters]]\nname = \"a\"\nhost = \"h\"\nport = 1\nhots = \"x\"\n",
+		"no-name.toml":   "[[clusters]]\nhost = \"h\"\nport = 1\n",
+		"duplicate.toml": "[[clusters]]\nname = \"a\"\nhost = \"h\"\nport = 1\n[[clusters]]\nname = \"a\"\nhost = \"h\"\nport = 1\n",
+		"role.yaml":      "clusters:\n  - {name: a, host: h, port: 1, role: master}\n",
+		"addr.yaml":      "clusters:\n  - {name: a, host: h}\n",
+		"layout.yaml":    "layout: tree\nclusters:\n  - {name: a, host: h, port: 1}\n",
+	}
+	for name, content := range cases {
+		_, err := workload.LoadTopology(s.writeFile(c, name, content))
+		c.Assert(err, NotNil, Commentf("file: %s", name))
+	}
+}
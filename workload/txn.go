@@ -0,0 +1,382 @@
+package workload
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/july2993/bitest/diff"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// InitialBalance is the balance of each account of the Txn workload before the transfers.
+const InitialBalance = 1000
+
+// the error numbers of MySQL and TiDB abort a transaction, it can be rolled back and go on
+const (
+	errLockWaitTimeout = 1205
+	errDeadlock        = 1213
+	errTxnRetryable    = 8002
+	errWriteConflict   = 9007
+)
+
+// TxnOptions is the options of Txn.
+type TxnOptions struct {
+	// Accounts is how many accounts to transfer between, 0 means DefaultTxnAccounts.
+	Accounts int64
+	// TxnNumber is the number of the transactions, 0 means DefaultTxnNumber.
+	TxnNumber int64
+	// MaxSize is the max number of transfers in a transaction, 0 means DefaultTxnMaxSize.
+	MaxSize int
+	// RollbackRate is the rate of the transactions rolled back on purpose.
+	RollbackRate float64
+	// CheckInterval is the interval between two snapshot reads of the downstream databases while running,
+	// 0 means DefaultTxnCheckInterval.
+	CheckInterval time.Duration
+}
+
+// The defaults of TxnOptions.
+const (
+	DefaultTxnAccounts      = 100
+	DefaultTxnNumber        = 10000
+	DefaultTxnMaxSize       = 8
+	DefaultTxnCheckInterval = 100 * time.Millisecond
+)
+
+func (o TxnOptions) withDefault() TxnOptions {
+	if o.Accounts == 0 {
+		o.Accounts = DefaultTxnAccounts
+	}
+	if o.TxnNumber == 0 {
+		o.TxnNumber = DefaultTxnNumber
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultTxnMaxSize
+	}
+	if o.CheckInterval == 0 {
+		o.CheckInterval = DefaultTxnCheckInterval
+	}
+	return o
+}
+
+// Txn runs the transactions of random transfers between the accounts in db1, each transaction writes the log
+// rows with its id and the number of the rows. It checks in the snapshot reads of the other databases that
+// the sum of the balances is constant and every transaction is either fully applied or absent.
+type Txn struct {
+	opts TxnOptions
+
+	dbs []*sql.DB
+
+	mu         sync.Mutex
+	committed  map[int64]int
+	rolledBack map[int64]struct{}
+}
+
+var _ Workload = &Txn{}
+
+// NewTxn returns a Txn workload.
+func NewTxn(opts TxnOptions) *Txn {
+	return &Txn{opts: opts.withDefault()}
+}
+
+func (w *Txn) Name() string { return "txn" }
+
+func (w *Txn) Short() string { return "test atomic replication of db1 -> db2 transactions" }
+
+func (w *Txn) Long() string {
+	return `
+Test the transactions of db1 are replicated to db2 atomically.
+1, create the tables in db1 and insert n accounts with the balance 1000:
+	create table txn_account(id bigint primary key, balance bigint);
+	create table txn_log(txn_id bigint, seq int, members int, primary key(txn_id, seq));
+
+2, run txn-number transactions in db1 concurrently, each one transfers between random accounts at most max-size times
+and inserts a row into txn_log for each transfer, with the transaction id and the number of the rows as members.
+Some transactions are rolled back on purpose by rollback-rate.
+Meanwhile, keep reading the snapshots of db2 and check the sum of the balances is constant, and every transaction
+in txn_log has all its members.
+
+3, check the databases converge, the sum of the balances is constant, all the committed transactions are in txn_log
+with all their members, and none of the rolled back ones.
+
+The statements of the committed transactions are recorded to the journal, they're replayed without the transactions.
+	`
+}
+
+func (w *Txn) Clusters() int { return 2 }
+
+func (w *Txn) Flags(fs *pflag.FlagSet) {
+	fs.Int64Var(&w.opts.Accounts, "n", DefaultTxnAccounts, "how many accounts to transfer between")
+	fs.Int64Var(&w.opts.TxnNumber, "txn-number", DefaultTxnNumber, "number of the transactions")
+	fs.IntVar(&w.opts.MaxSize, "max-size", DefaultTxnMaxSize, "max number of transfers in a transaction")
+	fs.Float64Var(&w.opts.RollbackRate, "rollback-rate", 0.1, "rate of the transactions rolled back on purpose")
+	fs.DurationVar(&w.opts.CheckInterval, "check-interval", DefaultTxnCheckInterval, "interval between two snapshot reads of db2 while running")
+}
+
+func (w *Txn) validateOptions(env *Env) error {
+	if w.opts.Accounts < 2 || w.opts.MaxSize < 1 {
+		return errors.Errorf("need 2 accounts and max size 1 at least")
+	}
+	return nil
+}
+
+func (w *Txn) Prepare(ctx context.Context, env *Env) error {
+	log.Info("config", zap.Int64("n", w.opts.Accounts),
+		zap.Int64("txn-number", w.opts.TxnNumber),
+		zap.Int("max-size", w.opts.MaxSize),
+		zap.Float64("rollback-rate", w.opts.RollbackRate))
+
+	var err error
+	w.dbs, err = OpenClusters(ctx, env.DSNs, env.P, env.Session)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	w.committed = make(map[int64]int)
+	w.rolledBack = make(map[int64]struct{})
+
+	e := env.Execer(w.dbs[0], 0, MainWorker)
+	for _, stmt := range []string{
+		"drop table if exists txn_account",
+		"drop table if exists txn_log",
+		"create table txn_account(id bigint primary key, balance bigint)",
+		"create table txn_log(txn_id bigint, seq int, members int, primary key(txn_id, seq))",
+	} {
+		_, err = e.ExecContext(ctx, stmt)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	err = env.checkConverge(ctx, w.dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for id := int64(1); id <= w.opts.Accounts; id++ {
+		_, err = e.ExecContext(ctx, "insert into txn_account(id, balance) values(?, ?)", id, InitialBalance)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(env.checkConverge(ctx, w.dbs))
+}
+
+// Run runs the transactions in db1, and checks the snapshots of the other databases until the transactions finish.
+func (w *Txn) Run(ctx context.Context, env *Env) error {
+	stop := make(chan struct{})
+	var checks errgroup.Group
+	for idx := 1; idx < len(w.dbs); idx++ {
+		idx := idx
+		checks.Go(func() error {
+			return w.keepCheck(ctx, idx, stop)
+		})
+	}
+
+	var eg errgroup.Group
+	for i := 0; i < env.P; i++ {
+		txns := w.opts.TxnNumber / int64(env.P)
+		if int64(i) < w.opts.TxnNumber%int64(env.P) {
+			txns++
+		}
+		i, rnd, e := i, env.Rand(0, i), env.Execer(w.dbs[0], 0, i)
+		eg.Go(func() error {
+			for j := int64(0); j < txns; j++ {
+				// the id is unique between the workers
+				txnID := j*int64(env.P) + int64(i) + 1
+				size := rnd.Intn(w.opts.MaxSize) + 1
+				rollback := rnd.Float64() < w.opts.RollbackRate
+				err := w.transfer(ctx, e, txnID, size, rollback, rnd.Int63n)
+				if err != nil {
+					return errors.Annotatef(err, "transaction %d", txnID)
+				}
+			}
+			return nil
+		})
+	}
+	err := eg.Wait()
+	close(stop)
+	cerr := checks.Wait()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(cerr)
+}
+
+// transfer runs a transaction of size transfers between random accounts and the log rows of them,
+// it's rolled back if rollback is true or aborted by the database.
+func (w *Txn) transfer(ctx context.Context, e *Execer, txnID int64, size int, rollback bool, random func(n int64) int64) error {
+	tx, err := e.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for seq := 0; seq < size && err == nil; seq++ {
+		from := random(w.opts.Accounts) + 1
+		to := random(w.opts.Accounts-1) + 1
+		if to >= from {
+			to++
+		}
+		amount := random(100) + 1
+		// update in the order of id to avoid deadlock
+		first, second, delta := from, to, -amount
+		if first > second {
+			first, second, delta = second, first, amount
+		}
+		_, err = tx.ExecContext(ctx, "update txn_account set balance = balance + ? where id = ?", delta, first)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "update txn_account set balance = balance + ? where id = ?", -delta, second)
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "insert into txn_log(txn_id, seq, members) values(?, ?, ?)", txnID, seq, size)
+		}
+	}
+
+	if err != nil || rollback {
+		if rerr := tx.Rollback(); rerr != nil && err == nil {
+			return errors.Trace(rerr)
+		}
+		if err != nil && !isTxnAborted(err) {
+			return errors.Trace(err)
+		}
+		w.mu.Lock()
+		w.rolledBack[txnID] = struct{}{}
+		w.mu.Unlock()
+		return nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		if !isTxnAborted(err) {
+			return errors.Trace(err)
+		}
+		// like the write conflict of the optimistic transaction of TiDB
+		w.mu.Lock()
+		w.rolledBack[txnID] = struct{}{}
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Lock()
+	w.committed[txnID] = size
+	w.mu.Unlock()
+	return nil
+}
+
+// isTxnAborted returns true if the database aborted the transaction, like a deadlock.
+func isTxnAborted(err error) bool {
+	if myErr, ok := errors.Cause(err).(*mysql.MySQLError); ok {
+		switch myErr.Number {
+		case errLockWaitTimeout, errDeadlock, errTxnRetryable, errWriteConflict:
+			return true
+		}
+	}
+	return false
+}
+
+// keepCheck checks the snapshots of the idx-th database every interval until stop is closed.
+func (w *Txn) keepCheck(ctx context.Context, idx int, stop chan struct{}) error {
+	interval := w.opts.CheckInterval
+	if interval == 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	var snapshots int64
+	for {
+		select {
+		case <-stop:
+			log.Info("check snapshots finished", zap.Int("db", idx+1), zap.Int64("snapshots", snapshots))
+			return nil
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-time.After(interval):
+		}
+
+		_, err := w.checkSnapshot(ctx, w.dbs[idx])
+		if err != nil {
+			if diff.IsRetryableError(err) {
+				log.Warn("check snapshot failed, will check again", zap.Int("db", idx+1), zap.Error(err))
+				continue
+			}
+			return errors.Annotatef(err, "db%d", idx+1)
+		}
+		snapshots++
+	}
+}
+
+// checkSnapshot checks the sum of the balances and the members of the transactions in a snapshot of db,
+// it returns the number of the rows of each transaction in txn_log.
+func (w *Txn) checkSnapshot(ctx context.Context, db *sql.DB) (map[int64]int, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	var accounts, sum int64
+	err = tx.QueryRowContext(ctx, "select count(*), coalesce(sum(balance), 0) from txn_account").Scan(&accounts, &sum)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if accounts != w.opts.Accounts || sum != w.opts.Accounts*InitialBalance {
+		return nil, errors.Errorf("%d accounts with the sum of balances %d, expected %d accounts with %d",
+			accounts, sum, w.opts.Accounts, w.opts.Accounts*InitialBalance)
+	}
+
+	rows, err := tx.QueryContext(ctx, "select txn_id, count(*), min(members), max(members) from txn_log group by txn_id")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	txns := make(map[int64]int)
+	for rows.Next() {
+		var txnID int64
+		var count, minMembers, maxMembers int
+		err = rows.Scan(&txnID, &count, &minMembers, &maxMembers)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if count != minMembers || count != maxMembers {
+			return nil, errors.Errorf("transaction %d has %d of %d members", txnID, count, maxMembers)
+		}
+		txns[txnID] = count
+	}
+	return txns, errors.Trace(rows.Err())
+}
+
+func (w *Txn) Verify(ctx context.Context, env *Env) error {
+	err := env.checkConverge(ctx, w.dbs)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for idx, db := range w.dbs {
+		txns, err := w.checkSnapshot(ctx, db)
+		if err != nil {
+			return errors.Annotatef(err, "db%d", idx+1)
+		}
+		for txnID := range txns {
+			if _, ok := w.rolledBack[txnID]; ok {
+				return errors.Errorf("db%d: transaction %d is rolled back but applied", idx+1, txnID)
+			}
+		}
+		for txnID, size := range w.committed {
+			if txns[txnID] != size {
+				return errors.Errorf("db%d: transaction %d is committed with %d members but got %d", idx+1, txnID, size, txns[txnID])
+			}
+		}
+	}
+
+	log.Info("transactions", zap.Int("committed", len(w.committed)), zap.Int("rolled-back", len(w.rolledBack)))
+	return nil
+}
+
+func (w *Txn) Cleanup(ctx context.Context, env *Env) error {
+	closeDBs(w.dbs...)
+	w.dbs = nil
+	return nil
+}
@@ -0,0 +1,116 @@
+package workload_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"github.com/july2993/bitest/diff"
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTxnSuite{})
+
+type testTxnSuite struct{}
+
+func (s *testTxnSuite) TestTxn(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	// both of the clusters are db1, so the snapshots of db2 are the snapshots of db1,
+	// and only one worker as the transactions of the test server are not isolated from each other
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0]},
+		P:       1,
+		Session: true,
+		Seed:    1,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	opts := workload.TxnOptions{Accounts: 10, TxnNumber: 100, MaxSize: 4, RollbackRate: 0.3, CheckInterval: time.Millisecond}
+	c.Assert(workload.RunRound(context.Background(), workload.NewTxn(opts), env, time.Minute), IsNil)
+}
+
+func (s *testTxnSuite) TestTxnTampered(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0]},
+		P:       1,
+		Session: true,
+		Seed:    1,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	opts := workload.TxnOptions{Accounts: 10, TxnNumber: 20, MaxSize: 4, CheckInterval: time.Millisecond}
+	tampers := []struct {
+		stmt string
+		err  string
+	}{
+		{"update db1.txn_account set balance = balance + 1 where id = 1", "db1: 10 accounts with the sum of balances 10001, expected 10 accounts with 10000"},
+		{"delete from db1.txn_log where members > 1 and seq = 0 limit 1", "db1: transaction [0-9]+ has [0-9]+ of [0-9]+ members"},
+	}
+	for _, tamper := range tampers {
+		ctx := context.Background()
+		w := workload.NewTxn(opts)
+		c.Assert(w.Prepare(ctx, env), IsNil)
+		c.Assert(w.Run(ctx, env), IsNil)
+		c.Assert(w.Verify(ctx, env), IsNil)
+
+		res, err := admin.Exec(tamper.stmt)
+		c.Assert(err, IsNil)
+		affected, err := res.RowsAffected()
+		c.Assert(err, IsNil)
+		c.Assert(affected, Equals, int64(1))
+		c.Assert(w.Verify(ctx, env), ErrorMatches, tamper.err)
+		c.Assert(w.Cleanup(ctx, env), IsNil)
+	}
+}
+
+func (s *testTxnSuite) TestTxnJournal(c *C) {
+	srv, admin, dsns := startServer(c)
+	defer srv.Close()
+	defer admin.Close()
+
+	path := filepath.Join(c.MkDir(), "journal")
+	journal, err := workload.OpenJournal(path)
+	c.Assert(err, IsNil)
+	env := &workload.Env{
+		DSNs:    []string{dsns[0], dsns[0]},
+		P:       1,
+		Session: true,
+		Seed:    1,
+		Journal: journal,
+		Check:   workload.CheckOptions{Timeout: time.Second, Interval: 10 * time.Millisecond},
+	}
+	opts := workload.TxnOptions{Accounts: 10, TxnNumber: 20, MaxSize: 4, RollbackRate: 0.5, CheckInterval: time.Millisecond}
+	c.Assert(workload.RunRound(context.Background(), workload.NewTxn(opts), env, time.Minute), IsNil)
+	c.Assert(journal.Close(), IsNil)
+
+	// the committed transactions are replayed to db2 to get the same data as db1
+	entries, err := workload.ReadJournal(path)
+	c.Assert(err, IsNil)
+	var transfers int
+	for _, e := range entries {
+		if e.Worker != workload.MainWorker {
+			transfers++
+		}
+	}
+	c.Assert(transfers > 0, IsTrue)
+	env = &workload.Env{DSNs: []string{dsns[1], dsns[1]}, Session: true, Check: env.Check}
+	err = workload.Replay(context.Background(), env, entries, workload.ReplayOptions{Mode: workload.ReplaySerial})
+	c.Assert(err, IsNil)
+
+	db1, err := sql.Open("mysql", dsns[0])
+	c.Assert(err, IsNil)
+	defer db1.Close()
+	db2, err := sql.Open("mysql", dsns[1])
+	c.Assert(err, IsNil)
+	defer db2.Close()
+	eq, err := diff.New(nil, db1, db2).Equal()
+	c.Assert(err, IsNil)
+	c.Assert(eq, IsTrue)
+}
@@ -0,0 +1,256 @@
+// Package workload contains the replication scenarios of bitest, they can be run by the bitest command
+// or embedded in the tests of a replication component.
+package workload
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// Workload is a replication scenario. A round of the workload runs Prepare, Run and Verify in order
+// and stops at the first error, then runs Cleanup if Prepare is called.
+type Workload interface {
+	// Name is the name of the workload, it's the sub command name of bitest too.
+	Name() string
+	Short() string
+	Long() string
+	// Clusters is how many databases the workload needs at least, the workload uses all the databases
+	// of Env if it supports more.
+	Clusters() int
+
+	// Prepare creates the tables and loads the initial data.
+	Prepare(ctx context.Context, env *Env) error
+	// Run runs the workload.
+	Run(ctx context.Context, env *Env) error
+	// Verify checks the databases are in the expected state after Run.
+	Verify(ctx context.Context, env *Env) error
+	// Cleanup releases what Prepare acquired, it's called even if a step failed.
+	Cleanup(ctx context.Context, env *Env) error
+}
+
+// FlagBinder is implemented by the workloads having options set by flags, the bitest command binds the flags
+// of the sub command by it. It's optional, the workloads used as a library are configured by their options.
+type FlagBinder interface {
+	// Flags binds the flags to the options of the workload.
+	Flags(fs *pflag.FlagSet)
+}
+
+// optionsValidator is implemented by the workloads checking their options before running a round.
+type optionsValidator interface {
+	validateOptions(env *Env) error
+}
+
+// Env is the options shared by all workloads.
+type Env struct {
+	// DSNs are the dsn of db1, db2, ..., the workloads run the DDL on db1.
+	DSNs []string
+	// Layout is how the databases replicate to each other, LayoutMesh if empty.
+	Layout Layout
+	// P is the max open connections to each database, it must be positive.
+	P int
+	// Session sets the variables like auto_increment_increment by session instead of global.
+	Session bool
+	// Check is how to check the data of db1 and db2 are equal.
+	Check CheckOptions
+	// NoBarrier checks the data without waiting for a Barrier first, for the replication that doesn't
+	// replicate the marker table.
+	NoBarrier bool
+	// Seed is the seed of the random sources got by Rand, the same seed produces the same statements
+	// for each worker. Run picks one by NewSeed if it's 0.
+	Seed int64
+	// Journal records the statements of the workload if not nil, the caller closes it.
+	Journal *Journal
+	// Heartbeat measures the replication lag while Run runs the rounds if the interval is set.
+	Heartbeat HeartbeatOptions
+
+	// round is the round of Run recorded in the journal.
+	round int
+}
+
+func (env *Env) layout() Layout {
+	if len(env.Layout) == 0 {
+		return LayoutMesh
+	}
+	return env.Layout
+}
+
+// validate checks env can run w.
+func (env *Env) validate(w Workload) error {
+	if len(env.DSNs) < w.Clusters() {
+		return errors.Errorf("workload %s needs %d databases, but got %d", w.Name(), w.Clusters(), len(env.DSNs))
+	}
+	if env.P <= 0 {
+		return errors.Errorf("the max open connections p must be positive, but got %d", env.P)
+	}
+	if v, ok := w.(optionsValidator); ok {
+		err := v.validateOptions(env)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	// the heartbeats are not written without the interval, so the others would be ignored silently
+	if env.Heartbeat.Interval == 0 && (env.Heartbeat.SLO > 0 || len(env.Heartbeat.Sources) > 0) {
+		return errors.New("the lag slo and sources of the heartbeats need the heartbeat interval")
+	}
+	return errors.Trace(env.layout().Validate())
+}
+
+func redactDSNs(dsns []string) []string {
+	redacted := make([]string, 0, len(dsns))
+	for _, dsn := range dsns {
+		redacted = append(redacted, RedactDSN(dsn))
+	}
+	return redacted
+}
+
+// RunOptions is how to run the rounds of a workload.
+type RunOptions struct {
+	// Loop runs the rounds again and again until meet error.
+	Loop bool
+	// Timeout is the timeout of each round, 0 means no timeout.
+	Timeout time.Duration
+}
+
+// Run runs the rounds of w. Each round after the first one runs with a seed derived from env.Seed,
+// which is logged, so the failed round can be run again with its seed.
+func Run(ctx context.Context, w Workload, env *Env, opts RunOptions) error {
+	if env.Seed == 0 {
+		env.Seed = NewSeed()
+	}
+	log.Info("config", zap.String("workload", w.Name()),
+		zap.Int64("seed", env.Seed),
+		zap.Strings("dsns", redactDSNs(env.DSNs)),
+		zap.String("layout", string(env.layout())),
+		zap.Int("p", env.P),
+		zap.Bool("session", env.Session),
+		zap.Bool("loop", opts.Loop),
+		zap.Duration("timeout", opts.Timeout))
+
+	err := env.validate(w)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(env.DSNs) > 1 {
+		log.Info("replication links", zap.Strings("links", formatLinks(env.layout().Links(len(env.DSNs)))))
+	}
+
+	if env.Heartbeat.Interval == 0 {
+		return runRounds(ctx, w, env, opts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	failure := make(chan error, 1)
+	hb, err := StartHeartbeat(ctx, env.DSNs, env.Heartbeat, func(err error) {
+		failure <- err
+		cancel()
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = runRounds(ctx, w, env, opts)
+	_, herr := hb.Stop()
+	select {
+	case ferr := <-failure:
+		return errors.Annotate(ferr, "heartbeat")
+	default:
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(herr)
+}
+
+func runRounds(ctx context.Context, w Workload, env *Env, opts RunOptions) error {
+	for round := 1; ; round++ {
+		start := time.Now()
+		roundEnv := *env
+		roundEnv.Seed = roundSeed(env.Seed, round)
+		roundEnv.round = round
+		log.Info("start round", zap.String("workload", w.Name()),
+			zap.Int("round", round),
+			zap.Int64("seed", roundEnv.Seed))
+		err := RunRound(ctx, w, &roundEnv, opts.Timeout)
+		if err != nil {
+			return errors.Annotatef(err, "round %d seed %d", round, roundEnv.Seed)
+		}
+
+		log.Info("test success", zap.String("workload", w.Name()),
+			zap.Int("round", round),
+			zap.Duration("duration", time.Since(start)))
+
+		if !opts.Loop {
+			return nil
+		}
+	}
+}
+
+// RunRound runs one round of w, it fails if not finished in timeout, 0 means no timeout.
+func RunRound(ctx context.Context, w Workload, env *Env, timeout time.Duration) (err error) {
+	err = env.validate(w)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// Cleanup runs without the timeout, so it can clean up a timeout round
+	cleanupCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		cerr := runStep(cleanupCtx, w, "cleanup", func() error { return w.Cleanup(cleanupCtx, env) })
+		if err == nil {
+			err = cerr
+		}
+		if env.Journal != nil {
+			if jerr := env.Journal.Flush(); err == nil {
+				err = jerr
+			}
+		}
+	}()
+
+	err = runStep(ctx, w, "prepare", func() error { return w.Prepare(ctx, env) })
+	if err != nil {
+		return err
+	}
+	err = runStep(ctx, w, "run", func() error { return w.Run(ctx, env) })
+	if err != nil {
+		return err
+	}
+	return runStep(ctx, w, "verify", func() error { return w.Verify(ctx, env) })
+}
+
+// runStep runs fn and logs how long it takes. Once ctx is done it fails, but still waits for fn to return,
+// so the next step like Cleanup never runs along with it, fn is expected to return soon after ctx is done.
+func runStep(ctx context.Context, w Workload, step string, fn func() error) error {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		<-done
+		err = errors.Trace(ctx.Err())
+	}
+	if err != nil {
+		return errors.Annotatef(err, "%s failed", step)
+	}
+
+	log.Info("step finished", zap.String("workload", w.Name()),
+		zap.String("step", step),
+		zap.Duration("duration", time.Since(start)))
+	return nil
+}
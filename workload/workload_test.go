@@ -0,0 +1,174 @@
+package workload_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/july2993/bitest/workload"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func TestClient(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testWorkloadSuite{})
+
+type testWorkloadSuite struct{}
+
+// fakeWorkload records the steps called, and fails or blocks at the step.
+type fakeWorkload struct {
+	mu     sync.Mutex
+	steps  []string
+	seeds  []int64
+	failAt string
+	hangAt string
+	rounds int
+}
+
+func (w *fakeWorkload) Name() string  { return "fake" }
+func (w *fakeWorkload) Short() string { return "" }
+func (w *fakeWorkload) Long() string  { return "" }
+func (w *fakeWorkload) Clusters() int { return 1 }
+
+func (w *fakeWorkload) step(ctx context.Context, name string) error {
+	w.mu.Lock()
+	w.steps = append(w.steps, name)
+	w.mu.Unlock()
+	if w.hangAt == name {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if w.failAt == name {
+		return errors.Errorf("%s fail", name)
+	}
+	return nil
+}
+
+func (w *fakeWorkload) Prepare(ctx context.Context, env *workload.Env) error {
+	w.seeds = append(w.seeds, env.Seed)
+	if w.rounds > 0 && len(w.seeds) > w.rounds {
+		return errors.New("enough rounds")
+	}
+	return w.step(ctx, "prepare")
+}
+func (w *fakeWorkload) Run(ctx context.Context, env *workload.Env) error { return w.step(ctx, "run") }
+func (w *fakeWorkload) Verify(ctx context.Context, env *workload.Env) error {
+	return w.step(ctx, "verify")
+}
+func (w *fakeWorkload) Cleanup(ctx context.Context, env *workload.Env) error {
+	return w.step(ctx, "cleanup")
+}
+
+func (s *testWorkloadSuite) TestRunRound(c *C) {
+	env := &workload.Env{DSNs: []string{"dsn"}, P: 1}
+	w := &fakeWorkload{}
+	c.Assert(workload.RunRound(context.Background(), w, env, 0), IsNil)
+	c.Assert(w.steps, DeepEquals, []string{"prepare", "run", "verify", "cleanup"})
+
+	w = &fakeWorkload{failAt: "run"}
+	err := workload.RunRound(context.Background(), w, env, 0)
+	c.Assert(err, ErrorMatches, "run failed: run fail")
+	c.Assert(w.steps, DeepEquals, []string{"prepare", "run", "cleanup"})
+
+	w = &fakeWorkload{failAt: "cleanup"}
+	err = workload.RunRound(context.Background(), w, env, 0)
+	c.Assert(err, ErrorMatches, "cleanup failed: cleanup fail")
+
+	w = &fakeWorkload{hangAt: "verify"}
+	err = workload.RunRound(context.Background(), w, env, 10*time.Millisecond)
+	c.Assert(errors.Cause(err), Equals, context.DeadlineExceeded)
+	c.Assert(w.steps, DeepEquals, []string{"prepare", "run", "verify", "cleanup"})
+}
+
+func (s *testWorkloadSuite) TestRun(c *C) {
+	env := &workload.Env{DSNs: []string{"dsn"}, P: 1}
+	w := &fakeWorkload{}
+	c.Assert(workload.Run(context.Background(), w, env, workload.RunOptions{}), IsNil)
+	c.Assert(w.steps, HasLen, 4)
+
+	c.Assert(env.Seed, Not(Equals), int64(0))
+
+	env.Seed = 42
+	w = &fakeWorkload{failAt: "verify"}
+	err := workload.Run(context.Background(), w, env, workload.RunOptions{Loop: true})
+	c.Assert(err, ErrorMatches, "round 1 seed 42: verify failed: verify fail")
+}
+
+func (s *testWorkloadSuite) TestSeed(c *C) {
+	env := &workload.Env{DSNs: []string{"dsn"}, P: 1, Seed: 42}
+	w := &fakeWorkload{rounds: 3}
+	err := workload.Run(context.Background(), w, env, workload.RunOptions{Loop: true})
+	c.Assert(err, ErrorMatches, "round 4 seed .*: prepare failed: enough rounds")
+	c.Assert(w.seeds, HasLen, 4)
+	c.Assert(w.seeds[0], Equals, int64(42))
+	c.Assert(w.seeds[1], Not(Equals), w.seeds[2])
+
+	// the same seed runs the same rounds
+	w2 := &fakeWorkload{rounds: 3}
+	workload.Run(context.Background(), w2, env, workload.RunOptions{Loop: true})
+	c.Assert(w2.seeds, DeepEquals, w.seeds)
+
+	// the same seed and ids get the same sequence, and the different ids get different ones
+	seq := func(r interface{ Int63() int64 }) []int64 {
+		return []int64{r.Int63(), r.Int63(), r.Int63()}
+	}
+	c.Assert(seq(env.Rand(0, 1)), DeepEquals, seq(env.Rand(0, 1)))
+	c.Assert(seq(env.Rand(0, 1)), Not(DeepEquals), seq(env.Rand(1, 0)))
+	c.Assert(seq(env.Rand(0, 1)), Not(DeepEquals), seq((&workload.Env{Seed: 43}).Rand(0, 1)))
+}
+
+func (s *testWorkloadSuite) TestInvalidEnv(c *C) {
+	w := &fakeWorkload{}
+	err := workload.Run(context.Background(), w, &workload.Env{}, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "workload fake needs 1 databases, but got 0")
+
+	env := &workload.Env{DSNs: []string{"dsn"}, P: 1, Layout: "tree"}
+	err = workload.Run(context.Background(), w, env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "unknown layout tree")
+
+	env = &workload.Env{DSNs: []string{"dsn"}}
+	err = workload.Run(context.Background(), w, env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "the max open connections p must be positive, but got 0")
+	c.Assert(w.steps, HasLen, 0)
+
+	env = &workload.Env{DSNs: []string{"dsn1", "dsn2"}, P: 1}
+	err = workload.Run(context.Background(), workload.NewDML(workload.DMLOptions{N: -1}), env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "n must be positive, but got -1")
+	err = workload.Run(context.Background(), workload.NewOffset(workload.OffsetOptions{Increment: -1}), env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "increment -1 and offset 1 must be positive")
+	err = workload.Run(context.Background(), workload.NewTxn(workload.TxnOptions{Accounts: 1}), env, workload.RunOptions{})
+	c.Assert(err, ErrorMatches, "need 2 accounts and max size 1 at least")
+}
+
+func (s *testWorkloadSuite) TestLayoutLinks(c *C) {
+	c.Assert(workload.LayoutStar.Links(3), DeepEquals, [][2]int{{0, 1}, {1, 0}, {0, 2}, {2, 0}})
+	c.Assert(workload.LayoutRing.Links(3), DeepEquals, [][2]int{{0, 1}, {1, 2}, {2, 0}})
+	c.Assert(workload.LayoutRing.Links(2), DeepEquals, [][2]int{{0, 1}, {1, 0}})
+	c.Assert(workload.LayoutMesh.Links(3), DeepEquals, [][2]int{{0, 1}, {0, 2}, {1, 0}, {1, 2}, {2, 0}, {2, 1}})
+}
+
+func (s *testWorkloadSuite) TestDSN(c *C) {
+	cfg := workload.DBConfig{User: "root", Password: "pw", Host: "127.0.0.1", Port: 4000}
+	dsn := cfg.DSN()
+	c.Assert(dsn, Equals, "root:pw@tcp(127.0.0.1:4000)/test?interpolateParams=true&readTimeout=1m&multiStatements=true")
+	c.Assert(workload.SessionDSN(dsn, 2, 1), Equals, dsn+"&auto_increment_increment=2&auto_increment_offset=1")
+}
+
+func (s *testWorkloadSuite) TestConflictPolicy(c *C) {
+	w1 := &workload.ConflictWrite{Src: 1, V: 10, TS: 100}
+	w2 := &workload.ConflictWrite{Src: 2, V: 20, TS: 200}
+	w3 := &workload.ConflictWrite{Src: 3, V: 30, TS: 200}
+
+	c.Assert(workload.PolicyLWW.Expected([]*workload.ConflictWrite{w1, w2}, 0), DeepEquals, []workload.ConflictWrite{*w2})
+	c.Assert(workload.PolicyLWW.Expected([]*workload.ConflictWrite{w2, w1, w3}, 0), DeepEquals, []workload.ConflictWrite{*w2, *w3})
+	c.Assert(workload.PolicySourcePriority.Expected([]*workload.ConflictWrite{w1, w2}, 0), DeepEquals, []workload.ConflictWrite{*w1})
+	c.Assert(workload.PolicySourcePriority.Expected([]*workload.ConflictWrite{nil, w2, w3}, 0), DeepEquals, []workload.ConflictWrite{*w2, *w3})
+	c.Assert(workload.PolicyEither.Expected([]*workload.ConflictWrite{w1, nil, w3}, 0), DeepEquals, []workload.ConflictWrite{*w1, *w3})
+	c.Assert(workload.PolicyEither.Expected([]*workload.ConflictWrite{nil, nil}, 0), IsNil)
+
+	c.Assert(workload.ConflictPolicy("first").Validate(), ErrorMatches, "unknown conflict policy first")
+}